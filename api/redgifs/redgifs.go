@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"kannonfoundry/whutbot3/api"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -23,7 +24,8 @@ func NewClient() *RedGifsClient {
 }
 
 var (
-	baseUrl = "https://api.redgifs.com/v2"
+	baseUrl  = "https://api.redgifs.com/v2"
+	watchUrl = "https://www.redgifs.com/watch/"
 )
 
 func (client *RedGifsClient) login() error {
@@ -77,8 +79,12 @@ type UrlResponse struct {
 	Sd string `json:"sd"`
 }
 type GifResponse struct {
-	Urls UrlResponse `json:"urls"`
-	Id   string      `json:"id"`
+	Urls   UrlResponse `json:"urls"`
+	Id     string      `json:"id"`
+	Width  int         `json:"width"`
+	Height int         `json:"height"`
+	Likes  int64       `json:"likes"`
+	Tags   []string    `json:"tags"`
 }
 type GifsResponse struct {
 	Gifs []GifResponse `json:"gifs"`
@@ -88,14 +94,22 @@ func (c *RedGifsClient) FormatAndModifySearch(tags []string, authorID int64) (se
 	return strings.Join(tags, " "), nil
 }
 
-func (c *RedGifsClient) Search(tags []string) (files []api.FileToSend, err error) {
+func (c *RedGifsClient) Search(tags []string) (files []api.Media, err error) {
+	return c.SearchPage(tags, 0)
+}
+
+func (c *RedGifsClient) SearchPage(tags []string, page int) (files []api.Media, err error) {
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("redgifs search needs a tag")
+	}
 	if c.IsTokenExpired() {
 		if err := c.login(); err != nil {
 			return nil, fmt.Errorf("failed to login: %w", err)
 		}
 	}
 
-	req, err := http.NewRequest("GET", baseUrl+"/gifs/search?search_text="+tags[0]+"&count=5", nil)
+	// redgifs numbers pages from 1
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/gifs/search?search_text=%s&count=5&page=%d", baseUrl, tags[0], page+1), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -115,19 +129,82 @@ func (c *RedGifsClient) Search(tags []string) (files []api.FileToSend, err error
 	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
 		return nil, err
 	}
-	var results []api.FileToSend
+	var results []api.Media
 	for _, gif := range searchResp.Gifs {
-		if gif.Urls.Sd != "" {
-			results = append(results, api.FileToSend{
-				Name: "redgif_" + gif.Urls.Sd,
-				URL:  gif.Urls.Sd,
-			})
-		} else if gif.Urls.Hd != "" {
-			results = append(results, api.FileToSend{
-				Name: "redgif_" + gif.Urls.Hd,
-				URL:  gif.Urls.Hd,
-			})
+		if media, ok := gif.toMedia(); ok {
+			results = append(results, media)
 		}
 	}
 	return results, nil
 }
+
+type SingleGifResponse struct {
+	Gif GifResponse `json:"gif"`
+}
+
+// Lookup fetches a single gif by its ID, so a saved gif can be found again
+// even if its file URLs have changed.
+func (c *RedGifsClient) Lookup(id string) (api.Media, error) {
+	if c.IsTokenExpired() {
+		if err := c.login(); err != nil {
+			return api.Media{}, fmt.Errorf("failed to login: %w", err)
+		}
+	}
+
+	req, err := http.NewRequest("GET", baseUrl+"/gifs/"+url.PathEscape(id), nil)
+	if err != nil {
+		return api.Media{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return api.Media{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return api.Media{}, api.ErrNoResults
+	}
+	if resp.StatusCode != http.StatusOK {
+		return api.Media{}, fmt.Errorf("lookup request failed: %s", resp.Status)
+	}
+	var gifResp SingleGifResponse
+	if err := json.NewDecoder(resp.Body).Decode(&gifResp); err != nil {
+		return api.Media{}, err
+	}
+	media, ok := gifResp.Gif.toMedia()
+	if !ok {
+		return api.Media{}, api.ErrNoResults
+	}
+	return media, nil
+}
+
+func (gif GifResponse) toMedia() (api.Media, bool) {
+	media := api.Media{
+		Provider: "redgifs",
+		ID:       gif.Id,
+		PostURL:  watchUrl + gif.Id,
+		Score:    gif.Likes,
+		Width:    gif.Width,
+		Height:   gif.Height,
+		Tags:     gif.Tags,
+	}
+	// sd stays the primary URL, since sent items are remembered by URL and
+	// it's the smaller download; hd is only used when there's no sd
+	if gif.Urls.Sd != "" {
+		media.FileToSend = api.FileToSend{
+			Name: "redgif_" + gif.Urls.Sd,
+			URL:  gif.Urls.Sd,
+		}
+	} else if gif.Urls.Hd != "" {
+		media.FileToSend = api.FileToSend{
+			Name: "redgif_" + gif.Urls.Hd,
+			URL:  gif.Urls.Hd,
+		}
+	} else {
+		return media, false
+	}
+	return media, true
+}
@@ -2,30 +2,41 @@ package rule34
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"kannonfoundry/whutbot3/api"
 	"kannonfoundry/whutbot3/config"
 	prefs "kannonfoundry/whutbot3/db/preferences"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 )
 
 type R34Posts []R34Post
 type R34Post struct {
-	ID       int64  `json:"id"`
-	Tags     string `json:"tags"`
-	FileURL  string `json:"file_url"`
-	Hash     string `json:"hash"`
-	FileName string `json:"image"`
+	ID         int64  `json:"id"`
+	Tags       string `json:"tags"`
+	FileURL    string `json:"file_url"`
+	Hash       string `json:"hash"`
+	FileName   string `json:"image"`
+	SampleURL  string `json:"sample_url"`
+	PreviewURL string `json:"preview_url"`
+	Score      int64  `json:"score"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
 }
 
 var (
 	baseUrl = "https://api.rule34.xxx/index.php?json=1&page=dapi&s=post&q=index"
+	postUrl = "https://rule34.xxx/index.php?page=post&s=view&id="
 )
 
-func getSearchUrl(tags []string) string {
+func getSearchUrl(tags []string, page int) string {
 	cfg := config.Default()
-	return fmt.Sprintf("%s&tags=%s&user_id=%s&api_key=%s", baseUrl, strings.Join(tags, "+"), cfg.R34UserID, cfg.R34ApiKey)
+	return fmt.Sprintf("%s&tags=%s&pid=%d&user_id=%s&api_key=%s", baseUrl, strings.Join(tags, "+"), page, cfg.R34UserID, cfg.R34ApiKey)
 }
 
 func NewClient() *R34MediaSearcher {
@@ -33,24 +44,53 @@ func NewClient() *R34MediaSearcher {
 }
 type R34MediaSearcher struct{}
 
-func (s *R34MediaSearcher) Search(tags []string) (file []api.FileToSend, err error) {
-	posts, err := GetPosts(tags)
+func (s *R34MediaSearcher) Search(tags []string) (file []api.Media, err error) {
+	return s.SearchPage(tags, 0)
+}
+
+func (s *R34MediaSearcher) SearchPage(tags []string, page int) (file []api.Media, err error) {
+	posts, err := GetPosts(tags, page)
 	if err != nil {
-		return []api.FileToSend{}, err
+		return []api.Media{}, err
 	}
 	if len(posts) == 0 {
-		return []api.FileToSend{}, fmt.Errorf("no posts found")
+		return []api.Media{}, api.ErrNoResults
 	}
-	var results = []api.FileToSend{}
+	var results = []api.Media{}
 	for _, post := range posts {
-		results = append(results, api.FileToSend{
-			Name: post.FileName,
-			URL:  post.FileURL,
-		})
+		results = append(results, post.toMedia())
 	}
 	return results, nil
 }
 
+func (p R34Post) toMedia() api.Media {
+	return api.Media{
+		FileToSend: api.FileToSend{
+			Name:       p.FileName,
+			URL:        p.FileURL,
+			Renditions: p.renditions(),
+		},
+		Provider: "rule34",
+		ID:       strconv.FormatInt(p.ID, 10),
+		PostURL:  postUrl + strconv.FormatInt(p.ID, 10),
+		Score:    p.Score,
+		Width:    p.Width,
+		Height:   p.Height,
+		Tags:     strings.Fields(p.Tags),
+	}
+}
+
+// renditions returns the post's smaller sample and preview images, largest first.
+func (p R34Post) renditions() []string {
+	var urls []string
+	for _, u := range []string{p.SampleURL, p.PreviewURL} {
+		if u != "" && u != p.FileURL {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
 func (s *R34MediaSearcher) FormatAndModifySearch(tags []string, authorID int64) (searchTerm string, err error) {
 	prefs, err := prefs.GetPreferences(authorID)
 	if err != nil {
@@ -63,10 +103,41 @@ func (s *R34MediaSearcher) FormatAndModifySearch(tags []string, authorID int64)
 	return searchTerm, nil
 }
 
-func GetPosts(tags []string) (R34Posts, error) {
+// SearchSince searches for posts uploaded after sinceID using rule34's id:>
+// meta tag, sorted by ascending ID so the first page holds the oldest.
+func (s *R34MediaSearcher) SearchSince(tags []string, sinceID int64) ([]api.Media, error) {
+	files, err := s.Search(append(slices.Clone(tags), fmt.Sprintf("id:>%d", sinceID), "sort:id:asc"))
+	if err == io.EOF || errors.Is(err, api.ErrNoResults) {
+		return []api.Media{}, nil
+	}
+	return files, err
+}
+
+// Lookup fetches a single post by its ID, so a saved post can be found again
+// even if its file URL has changed.
+func (s *R34MediaSearcher) Lookup(id string) (api.Media, error) {
+	posts, err := getPostsFrom(getPostUrl(id))
+	if err == io.EOF || (err == nil && len(posts) == 0) {
+		return api.Media{}, api.ErrNoResults
+	}
+	if err != nil {
+		return api.Media{}, err
+	}
+	return posts[0].toMedia(), nil
+}
+
+func getPostUrl(id string) string {
+	cfg := config.Default()
+	return fmt.Sprintf("%s&id=%s&user_id=%s&api_key=%s", baseUrl, url.QueryEscape(id), cfg.R34UserID, cfg.R34ApiKey)
+}
+
+func GetPosts(tags []string, page int) (R34Posts, error) {
+	return getPostsFrom(getSearchUrl(tags, page))
+}
+
+func getPostsFrom(endpoint string) (R34Posts, error) {
 	// Implementation for fetching posts from the Rule34 API
 
-	endpoint := getSearchUrl(tags)
 	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		return R34Posts{}, err
@@ -0,0 +1,100 @@
+package rule34
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"kannonfoundry/whutbot3/config"
+	"kannonfoundry/whutbot3/fuzzy"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type R34Tags struct {
+	Tags []R34Tag `xml:"tag"`
+}
+type R34Tag struct {
+	ID    int64  `xml:"id,attr"`
+	Name  string `xml:"name,attr"`
+	Count int64  `xml:"count,attr"`
+}
+
+var (
+	tagBaseUrl = "https://api.rule34.xxx/index.php?page=dapi&s=tag&q=index"
+)
+
+func getTagUrl(query url.Values) string {
+	cfg := config.Default()
+	query.Set("user_id", cfg.R34UserID)
+	query.Set("api_key", cfg.R34ApiKey)
+	return fmt.Sprintf("%s&%s", tagBaseUrl, query.Encode())
+}
+
+// SuggestTags checks each tag against the rule34 tag API and returns the
+// closest existing tag for any that are unknown or have no posts.
+// Negated and meta tags (e.g. "-foo", "score:>10") are not checked.
+func (s *R34MediaSearcher) SuggestTags(tags []string) (map[string]string, error) {
+	suggestions := map[string]string{}
+	for _, tag := range tags {
+		if tag == "" || strings.HasPrefix(tag, "-") || strings.Contains(tag, ":") {
+			continue
+		}
+		known, err := GetTags(url.Values{"name": {tag}})
+		if err != nil {
+			return suggestions, err
+		}
+		if len(known.Tags) > 0 && known.Tags[0].Count > 0 {
+			continue
+		}
+
+		// search for tags sharing a short prefix and pick the closest by edit distance
+		prefix := tag
+		if r := []rune(tag); len(r) > 3 {
+			prefix = string(r[:3])
+		}
+		candidates, err := GetTags(url.Values{
+			"name_pattern": {prefix + "%"},
+			"orderby":      {"count"},
+			"limit":        {"500"},
+		})
+		if err != nil {
+			return suggestions, err
+		}
+		var names []string
+		for _, c := range candidates.Tags {
+			if c.Count > 0 && c.Name != tag {
+				names = append(names, c.Name)
+			}
+		}
+		if closest := fuzzy.Closest(tag, names, 1); len(closest) > 0 {
+			suggestions[tag] = closest[0]
+		}
+	}
+	return suggestions, nil
+}
+
+func GetTags(query url.Values) (R34Tags, error) {
+	req, err := http.NewRequest("GET", getTagUrl(query), nil)
+	if err != nil {
+		return R34Tags{}, err
+	}
+	req.Close = true
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return R34Tags{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return R34Tags{}, fmt.Errorf("failed to fetch tags: %s", resp.Status)
+	}
+
+	var data R34Tags
+	if err := xml.NewDecoder(resp.Body).Decode(&data); err != nil && err != io.EOF {
+		return R34Tags{}, fmt.Errorf("error decoding tags: %w", err)
+	}
+	return data, nil
+}
@@ -1,11 +1,61 @@
 package api
 
+import "errors"
+
+// ErrNoResults is returned by a MediaSearcher when the search matched nothing.
+var ErrNoResults = errors.New("no posts found")
+
 type FileToSend struct{
 	Name string
 	URL  string
+	// Renditions are smaller alternatives to URL, tried in order when the
+	// original is too large to upload.
+	Renditions []string
+}
+
+// Media is a search result with the provider's metadata about the post.
+type Media struct {
+	FileToSend
+	Provider string
+	ID       string
+	PostURL  string
+	Score    int64
+	Width    int
+	Height   int
+	Tags     []string
 }
 
 type MediaSearcher interface {
-	Search(tags []string) (files []FileToSend, err error)
+	Search(tags []string) (files []Media, err error)
+	// FormatAndModifySearch applies any provider-specific modifications (such
+	// as preferences) to the tags, whose aliases callers have already expanded.
 	FormatAndModifySearch(tags []string, authorID int64) (searchTerm string, err error)
 }
+
+// TagSuggester is implemented by searchers that can look tags up against the
+// provider and suggest corrections for ones that don't exist.
+type TagSuggester interface {
+	// SuggestTags returns a map of unknown tag to its closest known tag.
+	SuggestTags(tags []string) (map[string]string, error)
+}
+
+// MediaLookup is implemented by searchers that can fetch a single post by the
+// provider's content ID.
+type MediaLookup interface {
+	Lookup(id string) (Media, error)
+}
+
+// NewPostsSearcher is implemented by searchers whose post IDs increase with
+// upload time, so callers can ask for only the posts newer than one they've seen.
+type NewPostsSearcher interface {
+	// SearchSince returns the oldest posts matching the tags with an ID above
+	// sinceID, oldest first, so callers working through them in order don't
+	// skip any. It returns no error when there are none.
+	SearchSince(tags []string, sinceID int64) (files []Media, err error)
+}
+
+// PagedSearcher is implemented by searchers that can fetch later pages of
+// results. Pages are numbered from 0; page 0 is what Search returns.
+type PagedSearcher interface {
+	SearchPage(tags []string, page int) (files []Media, err error)
+}
@@ -0,0 +1,191 @@
+package stashdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"kannonfoundry/whutbot3/config"
+)
+
+// ErrNotFound is returned when StashDB has no scene with the ID asked for.
+var ErrNotFound = errors.New("not found on StashDB")
+
+// Client queries the StashDB GraphQL API. Set Endpoint to point it at another
+// server, e.g. a test stand-in.
+type Client struct {
+	Endpoint   string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// NewClient builds a client from the StashDB settings in cfg.
+func NewClient(cfg *config.Config) *Client {
+	return &Client{
+		Endpoint:   cfg.StashDBURL,
+		APIKey:     cfg.StashDBAPIKey,
+		HTTPClient: &http.Client{Timeout: time.Duration(cfg.StashDBTimeoutSeconds) * time.Second},
+	}
+}
+
+// Scene is the metadata StashDB holds for a scene.
+type Scene struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	ReleaseDate string `json:"release_date"`
+	// Duration is in seconds.
+	Duration int `json:"duration"`
+	Studio   *struct {
+		Name string `json:"name"`
+	} `json:"studio"`
+	Performers []struct {
+		As        string `json:"as"`
+		Performer struct {
+			Name string `json:"name"`
+		} `json:"performer"`
+	} `json:"performers"`
+	Images []struct {
+		URL    string `json:"url"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	} `json:"images"`
+}
+
+// PerformerNames returns the names the performers are credited as.
+func (s Scene) PerformerNames() []string {
+	var names []string
+	for _, p := range s.Performers {
+		name := p.Performer.Name
+		if p.As != "" && p.As != name {
+			name = fmt.Sprintf("%s (as %s)", name, p.As)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// CoverURL returns the scene's widest image, or "" if it has none.
+func (s Scene) CoverURL() string {
+	cover, width := "", -1
+	for _, img := range s.Images {
+		if img.Width > width {
+			cover, width = img.URL, img.Width
+		}
+	}
+	return cover
+}
+
+const findSceneQuery = `query FindScene($id: ID!) {
+  findScene(id: $id) {
+    id
+    title
+    release_date
+    duration
+    studio { name }
+    performers { as performer { name } }
+    images { url width height }
+  }
+}`
+
+// FindScene fetches a scene's metadata by its StashDB ID.
+func (c *Client) FindScene(ctx context.Context, id string) (Scene, error) {
+	var data struct {
+		FindScene *Scene `json:"findScene"`
+	}
+	if err := c.query(ctx, findSceneQuery, map[string]any{"id": id}, &data); err != nil {
+		return Scene{}, err
+	}
+	if data.FindScene == nil {
+		return Scene{}, ErrNotFound
+	}
+	return *data.FindScene, nil
+}
+
+const countScenesQuery = `query CountScenes($input: SceneQueryInput!) {
+  queryScenes(input: $input) {
+    count
+  }
+}`
+
+// CountPerformerScenes returns how many scenes StashDB credits the performer in.
+func (c *Client) CountPerformerScenes(ctx context.Context, id string) (int, error) {
+	return c.countScenes(ctx, "performers", id)
+}
+
+// CountStudioScenes returns how many scenes StashDB has from the studio.
+func (c *Client) CountStudioScenes(ctx context.Context, id string) (int, error) {
+	return c.countScenes(ctx, "studios", id)
+}
+
+// countScenes counts the scenes matching one of queryScenes' ID criteria.
+func (c *Client) countScenes(ctx context.Context, criterion string, id string) (int, error) {
+	input := map[string]any{
+		criterion:  map[string]any{"value": []string{id}, "modifier": "INCLUDES"},
+		"per_page": 1,
+	}
+	var data struct {
+		QueryScenes struct {
+			Count int `json:"count"`
+		} `json:"queryScenes"`
+	}
+	if err := c.query(ctx, countScenesQuery, map[string]any{"input": input}, &data); err != nil {
+		return 0, err
+	}
+	return data.QueryScenes.Count, nil
+}
+
+// query runs a GraphQL query and decodes its data into out.
+func (c *Client) query(ctx context.Context, query string, variables map[string]any, out any) error {
+	if c.APIKey == "" {
+		return errors.New("STASHDB_API_KEY not set")
+	}
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("ApiKey", c.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		var messages []string
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("graphql error: %s", strings.Join(messages, "; "))
+	}
+	return json.Unmarshal(result.Data, out)
+}
@@ -0,0 +1,86 @@
+package stashdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSceneID = "2f8ab7e1-5c3d-4b6a-9e0f-1a2b3c4d5e6f"
+
+// newStandIn starts a GraphQL server that checks each request is a FindScene
+// query for testSceneID and answers with response.
+func newStandIn(t *testing.T, response string) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("ApiKey") != "test-key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var req struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !strings.Contains(req.Query, "findScene") || req.Variables["id"] != testSceneID {
+			t.Errorf("unexpected query %q with %v", req.Query, req.Variables)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return &Client{Endpoint: server.URL, APIKey: "test-key", HTTPClient: server.Client()}
+}
+
+func TestFindScene(t *testing.T) {
+	c := newStandIn(t, `{"data": {"findScene": {
+		"id": "`+testSceneID+`",
+		"title": "Some Scene",
+		"release_date": "2024-05-01",
+		"duration": 1800,
+		"studio": {"name": "Some Studio"},
+		"performers": [{"as": "", "performer": {"name": "Jane"}}, {"as": "J", "performer": {"name": "Joan"}}],
+		"images": [{"url": "small.jpg", "width": 300, "height": 200}, {"url": "big.jpg", "width": 1200, "height": 800}]
+	}}}`)
+
+	scene, err := c.FindScene(context.Background(), testSceneID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scene.Title != "Some Scene" || scene.Duration != 1800 || scene.Studio == nil || scene.Studio.Name != "Some Studio" {
+		t.Errorf("scene = %+v", scene)
+	}
+	if names := strings.Join(scene.PerformerNames(), ", "); names != "Jane, Joan (as J)" {
+		t.Errorf("performers = %q", names)
+	}
+	if cover := scene.CoverURL(); cover != "big.jpg" {
+		t.Errorf("cover = %q, want the widest image", cover)
+	}
+}
+
+func TestFindSceneNotFound(t *testing.T) {
+	c := newStandIn(t, `{"data": {"findScene": null}}`)
+
+	if _, err := c.FindScene(context.Background(), testSceneID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFindSceneGraphQLErrors(t *testing.T) {
+	c := newStandIn(t, `{"data": null, "errors": [{"message": "not authorized"}, {"message": "try again"}]}`)
+
+	_, err := c.FindScene(context.Background(), testSceneID)
+	if err == nil || !strings.Contains(err.Error(), "not authorized; try again") {
+		t.Errorf("err = %v, want the GraphQL errors", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, shouldn't be ErrNotFound", err)
+	}
+}
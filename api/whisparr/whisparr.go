@@ -0,0 +1,568 @@
+package whisparr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kannonfoundry/whutbot3/config"
+)
+
+// ErrNotFound is returned when Whisparr doesn't know the item asked for.
+var ErrNotFound = errors.New("not found in Whisparr")
+
+// StatusError is returned when Whisparr answers with an unexpected status.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.Code, e.Body)
+}
+
+// Unavailable reports whether err means Whisparr couldn't be reached or was
+// too busy or broken to answer, so the request may work if tried again later.
+func Unavailable(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Code >= 500 || status.Code == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Client talks to the Whisparr v3 API. The zero value isn't usable; build one
+// with NewClient, or set the fields directly (e.g. to point at a test server).
+type Client struct {
+	BaseURL string
+	APIKey  string
+	// RootFolder and QualityProfileID are used for added scenes that don't set
+	// their own.
+	RootFolder       string
+	QualityProfileID int
+	HTTPClient       *http.Client
+
+	tagsMu      sync.Mutex
+	tagsByLabel map[string]Tag
+}
+
+// NewClient builds a client from the Whisparr settings in cfg.
+func NewClient(cfg *config.Config) *Client {
+	return &Client{
+		BaseURL:          strings.TrimSuffix(cfg.WhisparrURL, "/"),
+		APIKey:           cfg.WhisparrAPIKey,
+		RootFolder:       cfg.WhisparrRootFolder,
+		QualityProfileID: cfg.WhisparrQualityProfileID,
+		HTTPClient:       &http.Client{Timeout: time.Duration(cfg.WhisparrTimeoutSeconds) * time.Second},
+	}
+}
+
+// Image is artwork attached to a movie.
+type Image struct {
+	CoverType string `json:"coverType"`
+	URL       string `json:"url,omitempty"`
+	RemoteURL string `json:"remoteUrl,omitempty"`
+}
+
+// AddOptions controls what Whisparr does right after adding a movie.
+type AddOptions struct {
+	SearchForMovie bool   `json:"searchForMovie"`
+	Monitor        string `json:"monitor,omitempty"`
+}
+
+// Movie is Whisparr's model for a scene (Whisparr calls everything a movie).
+type Movie struct {
+	ID               int         `json:"id,omitempty"`
+	Title            string      `json:"title"`
+	SortTitle        string      `json:"sortTitle,omitempty"`
+	Overview         string      `json:"overview,omitempty"`
+	Year             int         `json:"year,omitempty"`
+	ReleaseDate      string      `json:"releaseDate,omitempty"`
+	Runtime          int         `json:"runtime,omitempty"`
+	StudioTitle      string      `json:"studioTitle,omitempty"`
+	StudioForeignID  string      `json:"studioForeignId,omitempty"`
+	ForeignID        string      `json:"foreignId"`
+	ItemType         string      `json:"itemType,omitempty"`
+	Images           []Image     `json:"images,omitempty"`
+	Genres           []string    `json:"genres,omitempty"`
+	Credits          []Credit    `json:"credits,omitempty"`
+	Tags             []int       `json:"tags,omitempty"`
+	Monitored        bool        `json:"monitored"`
+	HasFile          bool        `json:"hasFile,omitempty"`
+	MovieFile        *MovieFile  `json:"movieFile,omitempty"`
+	Added            string      `json:"added,omitempty"`
+	QualityProfileID int         `json:"qualityProfileId,omitempty"`
+	RootFolderPath   string      `json:"rootFolderPath,omitempty"`
+	Path             string      `json:"path,omitempty"`
+	AddOptions       *AddOptions `json:"addOptions,omitempty"`
+}
+
+// InLibrary reports whether the movie has been added to Whisparr, as opposed
+// to only being known from a lookup.
+func (m Movie) InLibrary() bool {
+	added := strings.TrimSpace(m.Added)
+	// lookups report the zero time for movies that haven't been added
+	return m.ID != 0 || (added != "" && !strings.HasPrefix(added, "0001-01-01"))
+}
+
+// LookupScene looks a scene up by its StashDB ID. The movie is returned even
+// if it isn't in the library yet; use InLibrary to tell. If Whisparr answers
+// 404 or finds nothing it returns ErrNotFound, since a scene Whisparr can't
+// find can't be added either.
+func (c *Client) LookupScene(ctx context.Context, stashID string) (Movie, error) {
+	var items []struct {
+		Movie Movie `json:"movie"`
+	}
+	if err := c.lookup(ctx, "scene", stashID, &items); err != nil {
+		return Movie{}, err
+	}
+	if len(items) == 0 {
+		return Movie{}, ErrNotFound
+	}
+	return items[0].Movie, nil
+}
+
+// AddScene adds a movie returned by LookupScene as monitored and starts a
+// search for it. The client's root folder and quality profile are used unless
+// the movie sets its own.
+func (c *Client) AddScene(ctx context.Context, movie Movie) (Movie, error) {
+	if movie.ForeignID == "" {
+		return Movie{}, errors.New("empty scene id")
+	}
+	if movie.RootFolderPath == "" {
+		movie.RootFolderPath = c.RootFolder
+	}
+	if movie.QualityProfileID == 0 {
+		movie.QualityProfileID = c.QualityProfileID
+	}
+	movie.Monitored = true
+	movie.AddOptions = &AddOptions{SearchForMovie: true}
+
+	var added Movie
+	if err := c.do(ctx, http.MethodPost, "/api/v3/movie", nil, movie, &added); err != nil {
+		return Movie{}, fmt.Errorf("add failed: %w", err)
+	}
+	return added, nil
+}
+
+// Credit links a movie to a performer in it.
+type Credit struct {
+	Performer struct {
+		ForeignID string `json:"foreignId"`
+		Name      string `json:"name"`
+	} `json:"performer"`
+}
+
+// Performer is a performer Whisparr can monitor for new scenes.
+type Performer struct {
+	ID               int     `json:"id,omitempty"`
+	ForeignID        string  `json:"foreignId"`
+	FullName         string  `json:"fullName"`
+	Images           []Image `json:"images,omitempty"`
+	Tags             []int   `json:"tags,omitempty"`
+	Monitored        bool    `json:"monitored"`
+	SearchOnAdd      bool    `json:"searchOnAdd"`
+	QualityProfileID int     `json:"qualityProfileId,omitempty"`
+	RootFolderPath   string  `json:"rootFolderPath,omitempty"`
+}
+
+// Studio is a studio Whisparr can monitor for new scenes.
+type Studio struct {
+	ID               int     `json:"id,omitempty"`
+	ForeignID        string  `json:"foreignId"`
+	Title            string  `json:"title"`
+	Images           []Image `json:"images,omitempty"`
+	Tags             []int   `json:"tags,omitempty"`
+	Monitored        bool    `json:"monitored"`
+	SearchOnAdd      bool    `json:"searchOnAdd"`
+	QualityProfileID int     `json:"qualityProfileId,omitempty"`
+	RootFolderPath   string  `json:"rootFolderPath,omitempty"`
+}
+
+// LookupPerformer looks a performer up by their StashDB ID. A performer
+// already in Whisparr has a non-zero ID.
+func (c *Client) LookupPerformer(ctx context.Context, stashID string) (Performer, error) {
+	var items []struct {
+		Performer Performer `json:"performer"`
+	}
+	if err := c.lookup(ctx, "performer", stashID, &items); err != nil {
+		return Performer{}, err
+	}
+	if len(items) == 0 {
+		return Performer{}, ErrNotFound
+	}
+	return items[0].Performer, nil
+}
+
+// MonitorPerformer adds the performer as monitored, or starts monitoring them
+// if they are already in Whisparr, so their scenes are added as they appear.
+func (c *Client) MonitorPerformer(ctx context.Context, performer Performer) (Performer, error) {
+	if performer.ForeignID == "" {
+		return Performer{}, errors.New("empty performer id")
+	}
+	if performer.RootFolderPath == "" {
+		performer.RootFolderPath = c.RootFolder
+	}
+	if performer.QualityProfileID == 0 {
+		performer.QualityProfileID = c.QualityProfileID
+	}
+	performer.Monitored = true
+	performer.SearchOnAdd = true
+
+	var saved Performer
+	var err error
+	if performer.ID != 0 {
+		err = c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v3/performer/%d", performer.ID), nil, performer, &saved)
+	} else {
+		err = c.do(ctx, http.MethodPost, "/api/v3/performer", nil, performer, &saved)
+	}
+	if err != nil {
+		return Performer{}, fmt.Errorf("monitor failed: %w", err)
+	}
+	return saved, nil
+}
+
+// LookupStudio looks a studio up by its StashDB ID. A studio already in
+// Whisparr has a non-zero ID.
+func (c *Client) LookupStudio(ctx context.Context, stashID string) (Studio, error) {
+	var items []struct {
+		Studio Studio `json:"studio"`
+	}
+	if err := c.lookup(ctx, "studio", stashID, &items); err != nil {
+		return Studio{}, err
+	}
+	if len(items) == 0 {
+		return Studio{}, ErrNotFound
+	}
+	return items[0].Studio, nil
+}
+
+// MonitorStudio adds the studio as monitored, or starts monitoring it if it is
+// already in Whisparr.
+func (c *Client) MonitorStudio(ctx context.Context, studio Studio) (Studio, error) {
+	if studio.ForeignID == "" {
+		return Studio{}, errors.New("empty studio id")
+	}
+	if studio.RootFolderPath == "" {
+		studio.RootFolderPath = c.RootFolder
+	}
+	if studio.QualityProfileID == 0 {
+		studio.QualityProfileID = c.QualityProfileID
+	}
+	studio.Monitored = true
+	studio.SearchOnAdd = true
+
+	var saved Studio
+	var err error
+	if studio.ID != 0 {
+		err = c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v3/studio/%d", studio.ID), nil, studio, &saved)
+	} else {
+		err = c.do(ctx, http.MethodPost, "/api/v3/studio", nil, studio, &saved)
+	}
+	if err != nil {
+		return Studio{}, fmt.Errorf("monitor failed: %w", err)
+	}
+	return saved, nil
+}
+
+// Quality is the quality a file was downloaded or imported at.
+type Quality struct {
+	Quality struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"quality"`
+}
+
+func (q Quality) String() string {
+	return q.Quality.Name
+}
+
+// MovieFile is the imported file of a movie.
+type MovieFile struct {
+	ID           int     `json:"id"`
+	RelativePath string  `json:"relativePath"`
+	Size         int64   `json:"size"`
+	DateAdded    string  `json:"dateAdded"`
+	Quality      Quality `json:"quality"`
+}
+
+// QueueItem is a download Whisparr is tracking.
+type QueueItem struct {
+	ID                      int     `json:"id"`
+	MovieID                 int     `json:"movieId"`
+	Title                   string  `json:"title"`
+	Status                  string  `json:"status"`
+	TrackedDownloadStatus   string  `json:"trackedDownloadStatus"`
+	TrackedDownloadState    string  `json:"trackedDownloadState"`
+	Size                    float64 `json:"size"`
+	SizeLeft                float64 `json:"sizeleft"`
+	TimeLeft                string  `json:"timeleft"`
+	EstimatedCompletionTime string  `json:"estimatedCompletionTime"`
+	Quality                 Quality `json:"quality"`
+	DownloadClient          string  `json:"downloadClient"`
+	ErrorMessage            string  `json:"errorMessage"`
+	Movie                   *Movie  `json:"movie,omitempty"`
+}
+
+// Progress returns how much of the download is done, from 0 to 1.
+func (q QueueItem) Progress() float64 {
+	if q.Size <= 0 {
+		return 0
+	}
+	return (q.Size - q.SizeLeft) / q.Size
+}
+
+// queuePageSize is how many queue items Queue asks for; the queue is rarely
+// anywhere near this long.
+const queuePageSize = 200
+
+// Queue returns the downloads Whisparr is tracking, with their movies.
+func (c *Client) Queue(ctx context.Context) ([]QueueItem, error) {
+	var page struct {
+		TotalRecords int         `json:"totalRecords"`
+		Records      []QueueItem `json:"records"`
+	}
+	query := url.Values{
+		"page":         {"1"},
+		"pageSize":     {strconv.Itoa(queuePageSize)},
+		"includeMovie": {"true"},
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v3/queue", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return page.Records, nil
+}
+
+// Movie returns a movie in the library by its Whisparr ID.
+func (c *Client) Movie(ctx context.Context, id int) (Movie, error) {
+	var movie Movie
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v3/movie/%d", id), nil, nil, &movie); err != nil {
+		return Movie{}, err
+	}
+	return movie, nil
+}
+
+// QualityProfile is a set of qualities Whisparr will download.
+type QualityProfile struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// RootFolder is a library folder Whisparr can put movies in.
+type RootFolder struct {
+	ID         int    `json:"id"`
+	Path       string `json:"path"`
+	Accessible bool   `json:"accessible"`
+	FreeSpace  int64  `json:"freeSpace"`
+}
+
+// Tag is a label that can be applied to movies, performers and studios.
+type Tag struct {
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+}
+
+func (c *Client) QualityProfiles(ctx context.Context) ([]QualityProfile, error) {
+	var profiles []QualityProfile
+	if err := c.do(ctx, http.MethodGet, "/api/v3/qualityprofile", nil, nil, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+func (c *Client) RootFolders(ctx context.Context) ([]RootFolder, error) {
+	var folders []RootFolder
+	if err := c.do(ctx, http.MethodGet, "/api/v3/rootfolder", nil, nil, &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+func (c *Client) Tags(ctx context.Context) ([]Tag, error) {
+	var tags []Tag
+	if err := c.do(ctx, http.MethodGet, "/api/v3/tag", nil, nil, &tags); err != nil {
+		return nil, err
+	}
+	c.cacheTags(tags...)
+	return tags, nil
+}
+
+// EnsureTag returns the tag with the label, creating it if it doesn't exist.
+// Tags are remembered by label, so Whisparr's tag list is only fetched for
+// labels the client hasn't seen yet.
+func (c *Client) EnsureTag(ctx context.Context, label string) (Tag, error) {
+	if tag, ok := c.cachedTag(label); ok {
+		return tag, nil
+	}
+	if _, err := c.Tags(ctx); err != nil {
+		return Tag{}, err
+	}
+	if tag, ok := c.cachedTag(label); ok {
+		return tag, nil
+	}
+	var created Tag
+	if err := c.do(ctx, http.MethodPost, "/api/v3/tag", nil, Tag{Label: label}, &created); err != nil {
+		return Tag{}, fmt.Errorf("creating tag failed: %w", err)
+	}
+	c.cacheTags(created)
+	return created, nil
+}
+
+func (c *Client) cachedTag(label string) (Tag, bool) {
+	c.tagsMu.Lock()
+	defer c.tagsMu.Unlock()
+	tag, ok := c.tagsByLabel[strings.ToLower(label)]
+	return tag, ok
+}
+
+func (c *Client) cacheTags(tags ...Tag) {
+	c.tagsMu.Lock()
+	defer c.tagsMu.Unlock()
+	if c.tagsByLabel == nil {
+		c.tagsByLabel = map[string]Tag{}
+	}
+	for _, tag := range tags {
+		c.tagsByLabel[strings.ToLower(tag.Label)] = tag
+	}
+}
+
+// TagMovies adds the tags to movies already in the library, keeping their
+// existing tags.
+func (c *Client) TagMovies(ctx context.Context, movieIDs []int, tagIDs []int) error {
+	body := map[string]any{
+		"movieIds":  movieIDs,
+		"tags":      tagIDs,
+		"applyTags": "add",
+	}
+	return c.do(ctx, http.MethodPut, "/api/v3/movie/editor", nil, body, nil)
+}
+
+// SearchMovies asks Whisparr to search its indexers for the movies again.
+func (c *Client) SearchMovies(ctx context.Context, movieIDs []int) error {
+	body := map[string]any{
+		"name":     "MoviesSearch",
+		"movieIds": movieIDs,
+	}
+	return c.do(ctx, http.MethodPost, "/api/v3/command", nil, body, nil)
+}
+
+// SetMonitored starts or stops monitoring the movies.
+func (c *Client) SetMonitored(ctx context.Context, movieIDs []int, monitored bool) error {
+	body := map[string]any{
+		"movieIds":  movieIDs,
+		"monitored": monitored,
+	}
+	return c.do(ctx, http.MethodPut, "/api/v3/movie/editor", nil, body, nil)
+}
+
+// DeleteMovie removes a movie from the library, and its files from disk if
+// deleteFiles is set.
+func (c *Client) DeleteMovie(ctx context.Context, movieID int, deleteFiles bool) error {
+	query := url.Values{"deleteFiles": {strconv.FormatBool(deleteFiles)}}
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v3/movie/%d", movieID), query, nil, nil)
+}
+
+func (c *Client) lookup(ctx context.Context, kind string, stashID string, out any) error {
+	if stashID == "" {
+		return fmt.Errorf("empty %s id", kind)
+	}
+	return c.do(ctx, http.MethodGet, "/api/v3/lookup/"+kind, url.Values{"term": {stashID}}, nil, out)
+}
+
+// do sends a request to the API, encoding body as JSON if it isn't nil and
+// decoding the response into out if it isn't nil.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body any, out any) error {
+	if c.APIKey == "" {
+		return errors.New("WHISPAR_API_KEY not set")
+	}
+	endpoint := c.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(js)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Api-Key", c.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &StatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(b))}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// Webhook event types the bot acts on.
+const (
+	EventTest     = "Test"
+	EventGrab     = "Grab"
+	EventDownload = "Download"
+	EventHealth   = "Health"
+)
+
+// WebhookEvent is the body of a Whisparr webhook notification. Which fields
+// are set depends on EventType.
+type WebhookEvent struct {
+	EventType string `json:"eventType"`
+	Movie     *struct {
+		ID        int    `json:"id"`
+		Title     string `json:"title"`
+		ForeignID string `json:"foreignId"`
+	} `json:"movie,omitempty"`
+	Release *struct {
+		Quality      string `json:"quality"`
+		ReleaseTitle string `json:"releaseTitle"`
+	} `json:"release,omitempty"`
+	MovieFile *struct {
+		Quality      string `json:"quality"`
+		RelativePath string `json:"relativePath"`
+	} `json:"movieFile,omitempty"`
+	IsUpgrade bool `json:"isUpgrade"`
+	// Level, Message and WikiURL describe Health events.
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	WikiURL string `json:"wikiUrl"`
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -15,8 +18,67 @@ type Config struct {
 	R34ChannelID      string
 	R34ApiKey         string
 	R34UserID         string
+	// GimmeMaxCount caps how many results a single gimme command can post.
+	GimmeMaxCount int
+	// SubscriptionPollMinutes is how often tag subscriptions check for new posts.
+	SubscriptionPollMinutes int
+	// SubscriptionMaxPosts caps how many new posts a subscription posts per poll.
+	SubscriptionMaxPosts int
+	// SearchCacheMinutes is how long search results are reused; 0 disables the cache.
+	SearchCacheMinutes int
+	// SearchCachePersist backs the search cache with Postgres.
+	SearchCachePersist bool
+	// UserRateBurst and UserRateSeconds size each user's token bucket for media
+	// commands: UserRateBurst commands at once, then one every UserRateSeconds.
+	UserRateBurst   int
+	UserRateSeconds int
+	// ChannelRateBurst and ChannelRateSeconds do the same per channel.
+	ChannelRateBurst   int
+	ChannelRateSeconds int
+	// DailyMediaQuota caps each user's media commands per UTC day; 0 disables it.
+	DailyMediaQuota int
+	// ForbiddenTags are never searched for or posted, whatever users' preferences
+	// and aliases say. FORBIDDEN_TAGS adds to defaultForbiddenTags.
+	ForbiddenTags []string
+	// WhisparrURL, WhisparrAPIKey, WhisparrRootFolder and
+	// WhisparrQualityProfileID configure the Whisparr scenes are added to.
+	WhisparrURL              string
+	WhisparrAPIKey           string
+	WhisparrRootFolder       string
+	WhisparrQualityProfileID int
+	// WhisparrTimeoutSeconds bounds each request to Whisparr.
+	WhisparrTimeoutSeconds int
+	// WhisparrAdminRoleID is the role allowed to unmonitor and remove scenes;
+	// when unset, server admins are.
+	WhisparrAdminRoleID string
+	// WhisparrApproval holds scene requests from users without
+	// WhisparrApproverRoleID until an approver allows them. Approvers see
+	// requests in WhisparrApprovalChannelID, or the channel they were made in.
+	WhisparrApproval          bool
+	WhisparrApproverRoleID    string
+	WhisparrApprovalChannelID string
+	// WhisparrRetryAttempts caps how often a Whisparr operation that failed
+	// because Whisparr was unavailable is tried before it is given up on.
+	// Retries start WhisparrRetrySeconds apart and back off exponentially.
+	WhisparrRetryAttempts int
+	WhisparrRetrySeconds  int
+	// WhisparrWebhookAddr is where to listen for Whisparr's webhook
+	// notifications (e.g. ":8080"); empty disables the listener.
+	WhisparrWebhookAddr string
+	// WhisparrWebhookSecret, if set, must be sent with each notification as the
+	// basic auth password or the secret query parameter.
+	WhisparrWebhookSecret string
+	// StashDBURL and StashDBAPIKey configure the StashDB GraphQL API used to
+	// preview scenes before they are added.
+	StashDBURL    string
+	StashDBAPIKey string
+	// StashDBTimeoutSeconds bounds each request to StashDB.
+	StashDBTimeoutSeconds int
 }
 
+// defaultForbiddenTags are always forbidden.
+var defaultForbiddenTags = []string{"loli", "shota", "underage", "child", "toddler"}
+
 func Default() *Config {
 	cfg := &Config{
 		Token:             os.Getenv("DISCORD_TOKEN"),
@@ -26,6 +88,38 @@ func Default() *Config {
 		R34ChannelID:      os.Getenv("R34_CHANNEL_ID"),
 		R34ApiKey:         os.Getenv("R34_API_KEY"),
 		R34UserID:         os.Getenv("R34_USER_ID"),
+		GimmeMaxCount:     envInt("GIMME_MAX_COUNT", 5),
+
+		SubscriptionPollMinutes: envInt("SUBSCRIPTION_POLL_MINUTES", 10),
+		SubscriptionMaxPosts:    envInt("SUBSCRIPTION_MAX_POSTS", 3),
+		SearchCacheMinutes:      envInt("SEARCH_CACHE_MINUTES", 15),
+		SearchCachePersist:      envBool("SEARCH_CACHE_POSTGRES", false),
+		UserRateBurst:           envInt("USER_RATE_BURST", 3),
+		UserRateSeconds:         envInt("USER_RATE_SECONDS", 20),
+		ChannelRateBurst:        envInt("CHANNEL_RATE_BURST", 10),
+		ChannelRateSeconds:      envInt("CHANNEL_RATE_SECONDS", 5),
+		DailyMediaQuota:         envInt("DAILY_MEDIA_QUOTA", 0),
+		ForbiddenTags:           append(slices.Clone(defaultForbiddenTags), envList("FORBIDDEN_TAGS")...),
+
+		WhisparrURL:              os.Getenv("WHISPAR_DOMAIN"),
+		WhisparrAPIKey:           os.Getenv("WHISPAR_API_KEY"),
+		WhisparrRootFolder:       os.Getenv("ROOT_FOLDER"),
+		WhisparrQualityProfileID: envInt("QUALITY", 0),
+		WhisparrTimeoutSeconds:   envInt("WHISPARR_TIMEOUT_SECONDS", 15),
+		WhisparrAdminRoleID:      os.Getenv("WHISPARR_ADMIN_ROLE_ID"),
+
+		WhisparrApproval:          envBool("WHISPARR_APPROVAL", false),
+		WhisparrApproverRoleID:    os.Getenv("WHISPARR_APPROVER_ROLE_ID"),
+		WhisparrApprovalChannelID: os.Getenv("WHISPARR_APPROVAL_CHANNEL_ID"),
+
+		WhisparrRetryAttempts: envInt("WHISPARR_RETRY_ATTEMPTS", 8),
+		WhisparrRetrySeconds:  envInt("WHISPARR_RETRY_SECONDS", 60),
+
+		WhisparrWebhookAddr:   os.Getenv("WHISPARR_WEBHOOK_ADDR"),
+		WhisparrWebhookSecret: os.Getenv("WHISPARR_WEBHOOK_SECRET"),
+		StashDBURL:            envString("STASHDB_URL", "https://stashdb.org/graphql"),
+		StashDBAPIKey:         os.Getenv("STASHDB_API_KEY"),
+		StashDBTimeoutSeconds: envInt("STASHDB_TIMEOUT_SECONDS", 10),
 	}
 	newError := errors.New("config error")
 	errString := ""
@@ -55,3 +149,48 @@ func Default() *Config {
 	}
 	return cfg
 }
+
+// envString reads an optional setting, falling back to def when it is unset.
+func envString(key string, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt reads an optional integer setting, falling back to def when it is
+// unset or invalid.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("invalid %s %q, using %d", key, v, def)
+		return def
+	}
+	return i
+}
+
+// envBool reads an optional boolean setting, falling back to def when it is
+// unset or invalid.
+func envBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("invalid %s %q, using %t", key, v, def)
+		return def
+	}
+	return b
+}
+
+// envList reads an optional comma or space separated list, lowercased.
+func envList(key string) []string {
+	return strings.FieldsFunc(strings.ToLower(os.Getenv(key)), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
@@ -0,0 +1,164 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed five-field cron expression
+// (minute hour day-of-month month day-of-week).
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record whether the day fields were "*", which changes
+	// how they combine: when both are restricted a day matching either runs.
+	domAny, dowAny bool
+}
+
+var shortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type bounds struct {
+	min, max int
+}
+
+var (
+	minuteBounds = bounds{0, 59}
+	hourBounds   = bounds{0, 23}
+	domBounds    = bounds{1, 31}
+	monthBounds  = bounds{1, 12}
+	dowBounds    = bounds{0, 7}
+)
+
+// Parse parses a five-field cron expression or one of the @hourly, @daily,
+// @weekly, @monthly or @yearly shortcuts. Fields accept *, lists (1,2),
+// ranges (1-5) and steps (*/15, 0-30/10).
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if shortcut, ok := shortcuts[strings.ToLower(expr)]; ok {
+		expr = shortcut
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("cron expression %q needs 5 fields, got %d", expr, len(fields))
+	}
+
+	var s Schedule
+	var err error
+	if s.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return Schedule{}, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return Schedule{}, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseField(fields[2], domBounds); err != nil {
+		return Schedule{}, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseField(fields[3], monthBounds); err != nil {
+		return Schedule{}, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return Schedule{}, fmt.Errorf("day of week: %w", err)
+	}
+	// 7 is an alias for Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return s, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		lo, hi := b.min, b.max
+		if rangePart != "*" {
+			start, end, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(start); err != nil {
+				return 0, fmt.Errorf("invalid value %q", start)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(end); err != nil {
+					return 0, fmt.Errorf("invalid value %q", end)
+				}
+			} else if hasStep {
+				hi = b.max
+			}
+		}
+		if lo < b.min || hi > b.max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, b.min, b.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time strictly after t, to the minute, that matches
+// the schedule. The schedule is evaluated in t's location. It returns the
+// zero time if nothing matches within the next five years (e.g. "0 0 31 2 *").
+// Times skipped when clocks spring forward don't run that day.
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()))
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// forward returns next, the wall-clock time after t, making sure it is after t.
+// A wall-clock time in a DST gap doesn't exist and time.Date puts it before
+// the gap, which would leave Next stuck.
+func forward(t, next time.Time) time.Time {
+	for !next.After(t) {
+		next = next.Add(time.Hour)
+	}
+	return next
+}
+
+func (s Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,193 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // the DST cases need America/New_York wherever the tests run
+)
+
+// bits returns the bitmask Parse builds for the values.
+func bits(values ...int) uint64 {
+	var b uint64
+	for _, v := range values {
+		b |= 1 << uint(v)
+	}
+	return b
+}
+
+// span returns the bitmask for every value from lo to hi.
+func span(lo, hi int) uint64 {
+	var b uint64
+	for v := lo; v <= hi; v++ {
+		b |= 1 << uint(v)
+	}
+	return b
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Schedule
+	}{
+		{"* * * * *", Schedule{span(0, 59), span(0, 23), span(1, 31), span(1, 12), span(0, 7), true, true}},
+		{"0,30 9-17 * * 1-5", Schedule{bits(0, 30), span(9, 17), span(1, 31), span(1, 12), span(1, 5), true, false}},
+		{"*/15 */6 1,15 * *", Schedule{bits(0, 15, 30, 45), bits(0, 6, 12, 18), bits(1, 15), span(1, 12), span(0, 7), false, true}},
+		{"0-30/10 5/8 * 1-12/3 *", Schedule{bits(0, 10, 20, 30), bits(5, 13, 21), span(1, 31), bits(1, 4, 7, 10), span(0, 7), true, true}},
+		{"0 0 13 * 5", Schedule{bits(0), bits(0), bits(13), span(1, 12), bits(5), false, false}},
+		{"0 0 * * 7", Schedule{bits(0), bits(0), span(1, 31), span(1, 12), bits(0, 7), true, false}},
+		{"  15 10 * * *  ", Schedule{bits(15), bits(10), span(1, 31), span(1, 12), span(0, 7), true, true}},
+		{"@daily", Schedule{bits(0), bits(0), span(1, 31), span(1, 12), span(0, 7), true, true}},
+		{"@Weekly", Schedule{bits(0), bits(0), span(1, 31), span(1, 12), bits(0), true, false}},
+		{"@yearly", Schedule{bits(0), bits(0), bits(1), bits(1), span(0, 7), false, true}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"", "needs 5 fields"},
+		{"* * * *", "needs 5 fields"},
+		{"* * * * * *", "needs 5 fields"},
+		{"@every 5m", "needs 5 fields"},
+		{"60 * * * *", "minute"},
+		{"a * * * *", "minute"},
+		{"*/0 * * * *", "minute"},
+		{"*/x * * * *", "minute"},
+		{"30-10 * * * *", "minute"},
+		{"1-x * * * *", "minute"},
+		{"0, * * * *", "minute"},
+		{"* 24 * * *", "hour"},
+		{"* * 0 * *", "day of month"},
+		{"* * 32 * *", "day of month"},
+		{"* * * 0 *", "month"},
+		{"* * * 13 *", "month"},
+		{"* * * * 8", "day of week"},
+		{"* * * * -1", "day of week"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Parse(%q) error = %v, want one mentioning %q", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"next step", "*/15 * * * *", utc(2024, 9, 2, 10, 7), utc(2024, 9, 2, 10, 15)},
+		{"seconds are dropped", "*/15 * * * *", utc(2024, 9, 2, 10, 14).Add(59 * time.Second), utc(2024, 9, 2, 10, 15)},
+		{"strictly after", "30 10 * * *", utc(2024, 9, 2, 10, 30), utc(2024, 9, 3, 10, 30)},
+		{"later the same day", "30 10 * * *", utc(2024, 9, 2, 9, 0), utc(2024, 9, 2, 10, 30)},
+		{"month rollover", "0 0 1 * *", utc(2024, 1, 31, 12, 0), utc(2024, 2, 1, 0, 0)},
+		{"year rollover", "0 0 1 1 *", utc(2024, 6, 1, 0, 0), utc(2025, 1, 1, 0, 0)},
+		{"skips months without the day", "0 0 31 * *", utc(2024, 4, 1, 0, 0), utc(2024, 5, 31, 0, 0)},
+		{"leap day", "0 0 29 2 *", utc(2024, 3, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+		{"never", "0 0 31 2 *", utc(2024, 1, 1, 0, 0), time.Time{}},
+		{"day of week only", "0 0 * * 1", utc(2024, 9, 1, 0, 0), utc(2024, 9, 2, 0, 0)},
+		{"day of month only", "0 0 15 * *", utc(2024, 9, 1, 0, 0), utc(2024, 9, 15, 0, 0)},
+		{"7 is Sunday", "0 0 * * 7", utc(2024, 9, 2, 0, 0), utc(2024, 9, 8, 0, 0)},
+		{"day of week or day of month, weekday first", "0 0 13 * 5", utc(2024, 9, 1, 0, 0), utc(2024, 9, 6, 0, 0)},
+		{"day of week or day of month, day first", "0 0 13 * 5", utc(2024, 10, 12, 0, 0), utc(2024, 10, 13, 0, 0)},
+		{"day of week or day of month, both", "0 0 13 * 5", utc(2024, 9, 6, 0, 0), utc(2024, 9, 13, 0, 0)},
+		{"day of week and month", "0 0 * 2 1", utc(2024, 9, 1, 0, 0), utc(2025, 2, 3, 0, 0)},
+		{"wall clock across spring forward", "0 9 * * *", time.Date(2024, 3, 9, 9, 0, 0, 0, newYork), time.Date(2024, 3, 10, 9, 0, 0, 0, newYork)},
+		{"wall clock across fall back", "0 9 * * *", time.Date(2024, 11, 2, 9, 0, 0, 0, newYork), time.Date(2024, 11, 3, 9, 0, 0, 0, newYork)},
+		{"skipped in the spring forward gap", "30 2 * * *", time.Date(2024, 3, 10, 0, 0, 0, 0, newYork), time.Date(2024, 3, 11, 2, 30, 0, 0, newYork)},
+		{"hourly across spring forward", "0 * * * *", time.Date(2024, 3, 10, 1, 0, 0, 0, newYork), time.Date(2024, 3, 10, 3, 0, 0, 0, newYork)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: Parse(%q) error = %v", tt.name, tt.expr, err)
+		}
+		got := s.Next(tt.from)
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: Next(%v) = %v, want %v", tt.name, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestNextAcrossFallBack(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Parse("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1am happens twice on 2024-11-03; an hourly schedule runs once an hour
+	// in real time, so both get a run
+	first := time.Date(2024, 11, 3, 0, 0, 0, 0, newYork)
+	var got []time.Duration
+	for at := s.Next(first); at.Hour() < 3; at = s.Next(at) {
+		got = append(got, at.Sub(first))
+	}
+	want := []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour}
+	if len(got) != len(want) {
+		t.Fatalf("runs at %v after midnight, want %v", got, want)
+	}
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Errorf("runs at %v after midnight, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestDayMatches(t *testing.T) {
+	// 2024-09-13 is a Friday
+	friday13 := time.Date(2024, 9, 13, 0, 0, 0, 0, time.UTC)
+	friday6 := time.Date(2024, 9, 6, 0, 0, 0, 0, time.UTC)
+	monday16 := time.Date(2024, 9, 16, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		day  time.Time
+		want bool
+	}{
+		{"0 0 * * *", monday16, true},
+		{"0 0 13 * *", friday13, true},
+		{"0 0 13 * *", friday6, false},
+		{"0 0 * * 5", friday6, true},
+		{"0 0 * * 5", monday16, false},
+		// both restricted: either one matching is enough
+		{"0 0 13 * 5", friday13, true},
+		{"0 0 13 * 5", friday6, true},
+		{"0 0 16 * 5", monday16, true},
+		{"0 0 13 * 5", monday16, false},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.expr, err)
+		}
+		if got := s.dayMatches(tt.day); got != tt.want {
+			t.Errorf("Parse(%q).dayMatches(%s) = %v, want %v", tt.expr, tt.day.Format("Mon Jan 2"), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package aliases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Scope says whether an alias belongs to a single user or to a whole guild.
+type Scope string
+
+const (
+	UserScope  Scope = "user"
+	GuildScope Scope = "guild"
+)
+
+// maxExpansionDepth bounds how deeply aliases may reference other aliases.
+const maxExpansionDepth = 5
+
+var ErrAliasLoop = errors.New("alias expansion loops back on itself")
+
+type AliasItem struct {
+	Scope     Scope
+	OwnerID   int64
+	Name      string
+	Expansion string
+}
+type AliasItems []AliasItem
+
+func (a AliasItems) String() string {
+	var lines []string
+	for _, item := range a {
+		lines = append(lines, fmt.Sprintf("%s → %s", item.Name, item.Expansion))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func GetAliases(scope Scope, ownerID int64) (AliasItems, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	rows, err := dbpool.Query(context.Background(), "SELECT scope, owner_id, name, expansion FROM aliases WHERE scope = $1 AND owner_id = $2 ORDER BY name", string(scope), ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying aliases: %v", err)
+	}
+	defer rows.Close()
+
+	var aliases AliasItems
+	for rows.Next() {
+		var a AliasItem
+		var scope string
+		if err := rows.Scan(&scope, &a.OwnerID, &a.Name, &a.Expansion); err != nil {
+			return nil, fmt.Errorf("error scanning alias: %v", err)
+		}
+		a.Scope = Scope(scope)
+		aliases = append(aliases, a)
+	}
+	return aliases, nil
+}
+
+func SetAlias(scope Scope, ownerID int64, name string, expansion []string) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(),
+		"INSERT INTO aliases (scope, owner_id, name, expansion) VALUES ($1, $2, $3, $4) ON CONFLICT (scope, owner_id, name) DO UPDATE SET expansion = EXCLUDED.expansion",
+		string(scope), ownerID, name, strings.Join(expansion, " "))
+	if err != nil {
+		return fmt.Errorf("error saving alias: %v", err)
+	}
+	return nil
+}
+
+func RemoveAlias(scope Scope, ownerID int64, name string) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	a, err := dbpool.Exec(context.Background(), "DELETE FROM aliases WHERE scope = $1 AND owner_id = $2 AND name = $3", string(scope), ownerID, name)
+	if err != nil {
+		return fmt.Errorf("error deleting alias: %v", err)
+	}
+	if a.RowsAffected() == 0 {
+		return fmt.Errorf("no alias named %s", name)
+	}
+	return nil
+}
+
+// Expand replaces any tag that names an alias with the alias's tags. A user's
+// own aliases take precedence over the guild's. Aliases may reference other
+// aliases; an alias that (directly or indirectly) references itself is an error.
+func Expand(tags []string, userID int64, guildID int64) ([]string, error) {
+	lookup := map[string]string{}
+	if guildID != 0 {
+		guildAliases, err := GetAliases(GuildScope, guildID)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range guildAliases {
+			lookup[a.Name] = a.Expansion
+		}
+	}
+	userAliases, err := GetAliases(UserScope, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range userAliases {
+		lookup[a.Name] = a.Expansion
+	}
+	if len(lookup) == 0 {
+		return tags, nil
+	}
+	return expand(tags, lookup, map[string]bool{}, 0)
+}
+
+func expand(tags []string, lookup map[string]string, active map[string]bool, depth int) ([]string, error) {
+	var expanded []string
+	for _, tag := range tags {
+		expansion, ok := lookup[tag]
+		if !ok {
+			expanded = append(expanded, tag)
+			continue
+		}
+		if active[tag] || depth >= maxExpansionDepth {
+			return nil, fmt.Errorf("%w: %s", ErrAliasLoop, tag)
+		}
+		active[tag] = true
+		inner, err := expand(strings.Fields(expansion), lookup, active, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		delete(active, tag)
+		expanded = append(expanded, inner...)
+	}
+	return expanded, nil
+}
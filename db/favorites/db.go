@@ -0,0 +1,151 @@
+package favorites
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotFound = errors.New("no favorite with that number")
+
+// FavoriteItem is a post a user saved. It is keyed by the provider's content ID
+// so it can be found again if the file URL changes.
+type FavoriteItem struct {
+	ID        int64
+	UserID    int64
+	Provider  string
+	ContentID string
+	URL       string
+	Tags      []string
+}
+type FavoriteItems []FavoriteItem
+
+// AddFavorites saves the items for the user, skipping any already saved.
+func AddFavorites(userID int64, items FavoriteItems) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	// Begin a transaction
+	tx, err := dbpool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	for _, item := range items {
+		_, err = tx.Exec(context.Background(),
+			"INSERT INTO favorites (user_id, provider, content_id, url, tags, ts) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (user_id, provider, content_id) DO NOTHING",
+			userID, item.Provider, item.ContentID, item.URL, strings.Join(item.Tags, " "), time.Now().UnixMilli())
+		if err != nil {
+			return fmt.Errorf("error saving favorite: %v", err)
+		}
+	}
+	return tx.Commit(context.Background())
+}
+
+// ListFavorites returns a page of the user's favorites, oldest first, and how
+// many they have in total.
+func ListFavorites(userID int64, offset int, limit int) (FavoriteItems, int, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	var total int
+	err = dbpool.QueryRow(context.Background(), "SELECT COUNT(*) FROM favorites WHERE user_id = $1", userID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting favorites: %v", err)
+	}
+
+	rows, err := dbpool.Query(context.Background(),
+		"SELECT id, user_id, provider, content_id, url, tags FROM favorites WHERE user_id = $1 ORDER BY id OFFSET $2 LIMIT $3",
+		userID, offset, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying favorites: %v", err)
+	}
+	defer rows.Close()
+
+	var items FavoriteItems
+	for rows.Next() {
+		item, err := scanFavorite(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	return items, total, nil
+}
+
+// GetFavorite returns the user's nth favorite, counting from 1 in the order
+// ListFavorites returns them.
+func GetFavorite(userID int64, n int) (FavoriteItem, error) {
+	if n < 1 {
+		return FavoriteItem{}, ErrNotFound
+	}
+	items, _, err := ListFavorites(userID, n-1, 1)
+	if err != nil {
+		return FavoriteItem{}, err
+	}
+	if len(items) == 0 {
+		return FavoriteItem{}, ErrNotFound
+	}
+	return items[0], nil
+}
+
+// RemoveFavorite deletes the user's nth favorite.
+func RemoveFavorite(userID int64, n int) (FavoriteItem, error) {
+	item, err := GetFavorite(userID, n)
+	if err != nil {
+		return FavoriteItem{}, err
+	}
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return FavoriteItem{}, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(), "DELETE FROM favorites WHERE id = $1 AND user_id = $2", item.ID, userID)
+	if err != nil {
+		return FavoriteItem{}, fmt.Errorf("error deleting favorite: %v", err)
+	}
+	return item, nil
+}
+
+// UpdateURL stores a fresh file URL for a favorite after the provider moved it.
+func UpdateURL(id int64, url string) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(), "UPDATE favorites SET url = $1 WHERE id = $2", url, id)
+	if err != nil {
+		return fmt.Errorf("error updating favorite: %v", err)
+	}
+	return nil
+}
+
+func scanFavorite(rows pgx.Rows) (FavoriteItem, error) {
+	var item FavoriteItem
+	var tags string
+	if err := rows.Scan(&item.ID, &item.UserID, &item.Provider, &item.ContentID, &item.URL, &tags); err != nil {
+		return FavoriteItem{}, fmt.Errorf("error scanning favorite: %v", err)
+	}
+	item.Tags = strings.Fields(tags)
+	return item, nil
+}
@@ -0,0 +1,168 @@
+package feedback
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AffinityItem is how much a user likes (positive) or dislikes (negative) a tag,
+// learned from their reactions to posts carrying it.
+type AffinityItem struct {
+	Tag   string
+	Score int
+}
+type AffinityItems []AffinityItem
+
+func (a AffinityItems) String() string {
+	var tags []string
+	for _, item := range a {
+		tags = append(tags, fmt.Sprintf("%s (%+d)", item.Tag, item.Score))
+	}
+	return strings.Join(tags, ", ")
+}
+
+// RecordFeedback stores a user's reaction to a message and adds value to their
+// affinity for each of the message's tags. Reacting the same way twice to a
+// message only counts once.
+func RecordFeedback(userID int64, messageID int64, value int, tags []string) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	// Begin a transaction
+	tx, err := dbpool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	a, err := tx.Exec(context.Background(),
+		"INSERT INTO media_feedback (user_id, message_id, value) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		userID, messageID, value)
+	if err != nil {
+		return fmt.Errorf("error saving feedback: %v", err)
+	}
+	if a.RowsAffected() == 0 {
+		return nil
+	}
+	if err := adjustAffinities(context.Background(), tx, userID, value, tags); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// RemoveFeedback undoes a reaction previously stored with RecordFeedback.
+func RemoveFeedback(userID int64, messageID int64, value int, tags []string) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	// Begin a transaction
+	tx, err := dbpool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	a, err := tx.Exec(context.Background(),
+		"DELETE FROM media_feedback WHERE user_id = $1 AND message_id = $2 AND value = $3",
+		userID, messageID, value)
+	if err != nil {
+		return fmt.Errorf("error deleting feedback: %v", err)
+	}
+	if a.RowsAffected() == 0 {
+		return nil
+	}
+	if err := adjustAffinities(context.Background(), tx, userID, -value, tags); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+func adjustAffinities(ctx context.Context, tx pgx.Tx, userID int64, delta int, tags []string) error {
+	for _, tag := range tags {
+		_, err := tx.Exec(ctx,
+			"INSERT INTO tag_affinity (user_id, tag, score) VALUES ($1, $2, $3) ON CONFLICT (user_id, tag) DO UPDATE SET score = tag_affinity.score + EXCLUDED.score",
+			userID, tag, delta)
+		if err != nil {
+			return fmt.Errorf("error updating tag affinity: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetAffinities returns the user's learned affinity for every tag they've reacted to.
+func GetAffinities(userID int64) (map[string]int, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	rows, err := dbpool.Query(context.Background(), "SELECT tag, score FROM tag_affinity WHERE user_id = $1 AND score <> 0", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tag affinity: %v", err)
+	}
+	defer rows.Close()
+
+	affinities := map[string]int{}
+	for rows.Next() {
+		var tag string
+		var score int
+		if err := rows.Scan(&tag, &score); err != nil {
+			return nil, fmt.Errorf("error scanning tag affinity: %v", err)
+		}
+		affinities[tag] = score
+	}
+	return affinities, nil
+}
+
+// TopAffinities returns the user's limit most liked and most disliked tags.
+func TopAffinities(userID int64, limit int) (likes AffinityItems, dislikes AffinityItems, err error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	likes, err = queryAffinities(dbpool, "SELECT tag, score FROM tag_affinity WHERE user_id = $1 AND score > 0 ORDER BY score DESC, tag LIMIT $2", userID, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	dislikes, err = queryAffinities(dbpool, "SELECT tag, score FROM tag_affinity WHERE user_id = $1 AND score < 0 ORDER BY score ASC, tag LIMIT $2", userID, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return likes, dislikes, nil
+}
+
+func queryAffinities(dbpool *pgxpool.Pool, query string, userID int64, limit int) (AffinityItems, error) {
+	rows, err := dbpool.Query(context.Background(), query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tag affinity: %v", err)
+	}
+	defer rows.Close()
+
+	var items AffinityItems
+	for rows.Next() {
+		var item AffinityItem
+		if err := rows.Scan(&item.Tag, &item.Score); err != nil {
+			return nil, fmt.Errorf("error scanning tag affinity: %v", err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
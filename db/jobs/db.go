@@ -0,0 +1,148 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Kinds of Whisparr operation a job retries.
+const (
+	// KindLookup looks a requested scene up again and carries on with the
+	// request as if the lookup had worked the first time.
+	KindLookup = "lookup"
+	// KindAdd adds a confirmed scene.
+	KindAdd = "add"
+)
+
+// Statuses of a job. Jobs are queued until they succeed (done) or run out of
+// attempts (dead).
+const (
+	StatusQueued = "queued"
+	StatusDone   = "done"
+	StatusDead   = "dead"
+)
+
+// JobItem is a failed Whisparr operation for a scene request, waiting to be
+// retried at NextRun.
+type JobItem struct {
+	ID        int64
+	RequestID int64
+	Kind      string
+	Status    string
+	Attempts  int
+	LastError string
+	NextRun   time.Time
+	Time      time.Time
+}
+type JobItems []JobItem
+
+const jobColumns = "id, request_id, kind, status, attempts, last_error, next_run, ts"
+
+// AddJob queues a job after its first failed attempt.
+func AddJob(item JobItem) (int64, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	var id int64
+	err = dbpool.QueryRow(context.Background(),
+		"INSERT INTO whisparr_jobs (request_id, kind, status, attempts, last_error, next_run, ts) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		item.RequestID, item.Kind, StatusQueued, item.Attempts, item.LastError, item.NextRun.UnixMilli(), time.Now().UnixMilli()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error saving job: %v", err)
+	}
+	return id, nil
+}
+
+// GetDueJobs returns the queued jobs whose next attempt is due.
+func GetDueJobs(now time.Time) (JobItems, error) {
+	return queryJobs("SELECT "+jobColumns+" FROM whisparr_jobs WHERE status = $1 AND next_run <= $2 ORDER BY next_run", StatusQueued, now.UnixMilli())
+}
+
+// GetJobs returns the limit most recent jobs with the given status, newest first.
+func GetJobs(status string, limit int) (JobItems, error) {
+	return queryJobs("SELECT "+jobColumns+" FROM whisparr_jobs WHERE status = $1 ORDER BY id DESC LIMIT $2", status, limit)
+}
+
+// RecordFailure stores a failed attempt, scheduling the next one at nextRun or,
+// if dead, giving up on the job.
+func RecordFailure(id int64, attempts int, lastError string, nextRun time.Time, dead bool) error {
+	status := StatusQueued
+	if dead {
+		status = StatusDead
+	}
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(),
+		"UPDATE whisparr_jobs SET status = $2, attempts = $3, last_error = $4, next_run = $5 WHERE id = $1",
+		id, status, attempts, lastError, nextRun.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("error updating job: %v", err)
+	}
+	return nil
+}
+
+// MarkDone records that a job's operation finally worked.
+func MarkDone(id int64, attempts int) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(), "UPDATE whisparr_jobs SET status = $2, attempts = $3 WHERE id = $1", id, StatusDone, attempts)
+	if err != nil {
+		return fmt.Errorf("error updating job: %v", err)
+	}
+	return nil
+}
+
+func queryJobs(query string, args ...any) (JobItems, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	rows, err := dbpool.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying jobs: %v", err)
+	}
+	defer rows.Close()
+
+	var items JobItems
+	for rows.Next() {
+		item, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func scanJob(rows pgx.Rows) (JobItem, error) {
+	var item JobItem
+	var nextRun, ts int64
+	if err := rows.Scan(&item.ID, &item.RequestID, &item.Kind, &item.Status, &item.Attempts, &item.LastError, &nextRun, &ts); err != nil {
+		return JobItem{}, fmt.Errorf("error scanning job: %v", err)
+	}
+	item.NextRun = time.UnixMilli(nextRun)
+	item.Time = time.UnixMilli(ts)
+	return item, nil
+}
@@ -0,0 +1,81 @@
+package lastquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotFound = errors.New("no previous query")
+
+// LastQuery is the most recent search a user ran, with the final tags sent to
+// the provider (after aliases, preferences and relaxation) and the page
+// "more" should continue from. Query is the tags as the user typed them.
+type LastQuery struct {
+	UserID   int64
+	Provider string
+	Tags     []string
+	Query    string
+	Page     int
+}
+
+// SaveLastQuery replaces the user's last query, starting it at page 0.
+func SaveLastQuery(q LastQuery) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(),
+		"INSERT INTO last_queries (user_id, provider, search_term, query, page, ts) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (user_id) DO UPDATE SET provider = EXCLUDED.provider, search_term = EXCLUDED.search_term, query = EXCLUDED.query, page = EXCLUDED.page, ts = EXCLUDED.ts",
+		q.UserID, q.Provider, strings.Join(q.Tags, " "), q.Query, q.Page, time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("error saving last query: %v", err)
+	}
+	return nil
+}
+
+func GetLastQuery(userID int64) (LastQuery, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return LastQuery{}, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	q := LastQuery{UserID: userID}
+	var searchTerm string
+	err = dbpool.QueryRow(context.Background(), "SELECT provider, search_term, query, page FROM last_queries WHERE user_id = $1", userID).Scan(&q.Provider, &searchTerm, &q.Query, &q.Page)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return LastQuery{}, ErrNotFound
+	}
+	if err != nil {
+		return LastQuery{}, fmt.Errorf("error querying last query: %v", err)
+	}
+	q.Tags = strings.Fields(searchTerm)
+	return q, nil
+}
+
+// SetPage moves the user's page cursor.
+func SetPage(userID int64, page int) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(), "UPDATE last_queries SET page = $2, ts = $3 WHERE user_id = $1", userID, page, time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("error updating last query: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package posts
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostItem records a media result the bot posted, so later interactions with
+// the message (buttons, reactions) know what it contained and who asked for it.
+type PostItem struct {
+	MessageID   int64
+	ChannelID   int64
+	RequesterID int64
+	Provider    string
+	ContentID   string
+	URL         string
+	Tags        []string
+	Query       string
+}
+type PostItems []PostItem
+
+// Tags returns the distinct tags across all the posts, in order.
+func (p PostItems) Tags() []string {
+	seen := map[string]bool{}
+	var tags []string
+	for _, item := range p {
+		for _, tag := range item.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func RecordPosts(items PostItems) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	// Begin a transaction
+	tx, err := dbpool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	for _, item := range items {
+		_, err = tx.Exec(context.Background(),
+			"INSERT INTO media_posts (message_id, channel_id, requester_id, provider, content_id, url, tags, query) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			item.MessageID, item.ChannelID, item.RequesterID, item.Provider, item.ContentID, item.URL, strings.Join(item.Tags, " "), item.Query)
+		if err != nil {
+			return fmt.Errorf("error saving post: %v", err)
+		}
+	}
+	return tx.Commit(context.Background())
+}
+
+func GetPosts(messageID int64) (PostItems, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	rows, err := dbpool.Query(context.Background(),
+		"SELECT message_id, channel_id, requester_id, provider, content_id, url, tags, query FROM media_posts WHERE message_id = $1 ORDER BY id", messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying posts: %v", err)
+	}
+	defer rows.Close()
+
+	var items PostItems
+	for rows.Next() {
+		var p PostItem
+		var tags string
+		if err := rows.Scan(&p.MessageID, &p.ChannelID, &p.RequesterID, &p.Provider, &p.ContentID, &p.URL, &tags, &p.Query); err != nil {
+			return nil, fmt.Errorf("error scanning post: %v", err)
+		}
+		p.Tags = strings.Fields(tags)
+		items = append(items, p)
+	}
+	return items, nil
+}
+
+func DeletePosts(messageID int64) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(), "DELETE FROM media_posts WHERE message_id = $1", messageID)
+	if err != nil {
+		return fmt.Errorf("error deleting posts: %v", err)
+	}
+	return nil
+}
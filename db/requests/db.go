@@ -0,0 +1,195 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Outcomes of a request. A request starts out pending while its preview
+// waits for confirmation, or awaiting approval when an approver has to allow
+// it, is adding while the confirmed add runs, and is retrying while a
+// Whisparr operation waits to be tried again.
+const (
+	OutcomePending   = "pending"
+	OutcomeAwaiting  = "awaiting approval"
+	OutcomeRejected  = "rejected"
+	OutcomeAdding    = "adding"
+	OutcomeRetrying  = "retrying"
+	OutcomeCancelled = "cancelled"
+	OutcomePresent   = "present"
+	OutcomeAdded     = "added"
+	OutcomeFailed    = "failed"
+)
+
+var ErrNotFound = errors.New("no request with that ID")
+
+// RequestItem records who asked for a scene, from which Discord message, and
+// what came of it. Requests for scenes that haven't been imported yet stay
+// pending until the requester is told about the import.
+type RequestItem struct {
+	ID        int64
+	ForeignID string
+	Title     string
+	Outcome   string
+	GuildID   int64
+	ChannelID int64
+	MessageID int64
+	UserID    int64
+	// QualityProfileID, RootFolder and Tags are the add options the request
+	// asked for, kept until it is confirmed.
+	QualityProfileID int
+	RootFolder       string
+	Tags             []int
+	Notified         bool
+	Time             time.Time
+}
+type RequestItems []RequestItem
+
+const requestColumns = "id, foreign_id, title, outcome, guild_id, channel_id, message_id, user_id, quality_profile_id, root_folder, tags, notified, ts"
+
+func AddRequest(item RequestItem) (int64, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	var id int64
+	err = dbpool.QueryRow(context.Background(),
+		"INSERT INTO scene_requests (foreign_id, title, outcome, guild_id, channel_id, message_id, user_id, quality_profile_id, root_folder, tags, notified, ts) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id",
+		item.ForeignID, item.Title, item.Outcome, item.GuildID, item.ChannelID, item.MessageID, item.UserID, item.QualityProfileID, item.RootFolder, tags(item.Tags), item.Notified, time.Now().UnixMilli()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error saving request: %v", err)
+	}
+	return id, nil
+}
+
+// GetPendingRequests returns the requests for a scene whose requesters haven't
+// been told it was imported yet.
+func GetPendingRequests(foreignID string) (RequestItems, error) {
+	return queryRequests("SELECT "+requestColumns+" FROM scene_requests WHERE foreign_id = $1 AND outcome IN ($2, $3) AND NOT notified ORDER BY id",
+		foreignID, OutcomePresent, OutcomeAdded)
+}
+
+func GetRequest(id int64) (RequestItem, error) {
+	items, err := queryRequests("SELECT "+requestColumns+" FROM scene_requests WHERE id = $1", id)
+	if err != nil {
+		return RequestItem{}, err
+	}
+	if len(items) == 0 {
+		return RequestItem{}, ErrNotFound
+	}
+	return items[0], nil
+}
+
+// ClaimRequest moves a request from one outcome to another, reporting false if
+// it wasn't in the from outcome (e.g. someone else already handled it).
+func ClaimRequest(id int64, from string, to string) (bool, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return false, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	a, err := dbpool.Exec(context.Background(), "UPDATE scene_requests SET outcome = $3 WHERE id = $1 AND outcome = $2", id, from, to)
+	if err != nil {
+		return false, fmt.Errorf("error updating request: %v", err)
+	}
+	return a.RowsAffected() > 0, nil
+}
+
+// SetOutcome records what came of a request once it has been handled.
+func SetOutcome(id int64, outcome string, title string, notified bool) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(),
+		"UPDATE scene_requests SET outcome = $2, title = COALESCE(NULLIF($3, ''), title), notified = $4 WHERE id = $1",
+		id, outcome, title, notified)
+	if err != nil {
+		return fmt.Errorf("error updating request: %v", err)
+	}
+	return nil
+}
+
+// GetUserRequests returns the user's limit most recent requests, newest first.
+func GetUserRequests(userID int64, limit int) (RequestItems, error) {
+	return queryRequests("SELECT "+requestColumns+" FROM scene_requests WHERE user_id = $1 ORDER BY id DESC LIMIT $2", userID, limit)
+}
+
+// GetRecentRequests returns the limit most recent requests from a guild, newest first.
+func GetRecentRequests(guildID int64, limit int) (RequestItems, error) {
+	return queryRequests("SELECT "+requestColumns+" FROM scene_requests WHERE guild_id = $1 ORDER BY id DESC LIMIT $2", guildID, limit)
+}
+
+// MarkNotified records that the request's requester was told about the import.
+func MarkNotified(id int64) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(), "UPDATE scene_requests SET notified = true WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("error updating request: %v", err)
+	}
+	return nil
+}
+
+func queryRequests(query string, args ...any) (RequestItems, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	rows, err := dbpool.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying requests: %v", err)
+	}
+	defer rows.Close()
+
+	var items RequestItems
+	for rows.Next() {
+		item, err := scanRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func scanRequest(rows pgx.Rows) (RequestItem, error) {
+	var item RequestItem
+	var ts int64
+	if err := rows.Scan(&item.ID, &item.ForeignID, &item.Title, &item.Outcome, &item.GuildID, &item.ChannelID, &item.MessageID, &item.UserID,
+		&item.QualityProfileID, &item.RootFolder, &item.Tags, &item.Notified, &ts); err != nil {
+		return RequestItem{}, fmt.Errorf("error scanning request: %v", err)
+	}
+	item.Time = time.UnixMilli(ts)
+	return item, nil
+}
+
+// tags stores a nil tag list as an empty array, since the column isn't nullable.
+func tags(ids []int) []int {
+	if ids == nil {
+		return []int{}
+	}
+	return ids
+}
@@ -0,0 +1,176 @@
+package schedules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotFound = errors.New("no schedule with that ID in this channel")
+
+// ScheduleItem is a saved query posted to a channel whenever its cron
+// expression fires.
+type ScheduleItem struct {
+	ID        int64
+	GuildID   int64
+	ChannelID int64
+	CreatorID int64
+	Cron      string
+	Provider  string
+	Query     string
+	Paused    bool
+	// LastRun is when the schedule last fired, or when it was created if it
+	// hasn't fired yet.
+	LastRun time.Time
+}
+type ScheduleItems []ScheduleItem
+
+const scheduleColumns = "id, guild_id, channel_id, creator_id, cron, provider, query, paused, last_run"
+
+func AddSchedule(item ScheduleItem) (int64, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	var id int64
+	err = dbpool.QueryRow(context.Background(),
+		"INSERT INTO schedules (guild_id, channel_id, creator_id, cron, provider, query, paused, last_run) VALUES ($1, $2, $3, $4, $5, $6, false, $7) RETURNING id",
+		item.GuildID, item.ChannelID, item.CreatorID, item.Cron, item.Provider, item.Query, time.Now().UnixMilli()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error saving schedule: %v", err)
+	}
+	return id, nil
+}
+
+// GetSchedules returns the schedules posting to a channel.
+func GetSchedules(channelID int64) (ScheduleItems, error) {
+	return querySchedules("SELECT "+scheduleColumns+" FROM schedules WHERE channel_id = $1 ORDER BY id", channelID)
+}
+
+// GetActiveSchedules returns every schedule that isn't paused.
+func GetActiveSchedules() (ScheduleItems, error) {
+	return querySchedules("SELECT " + scheduleColumns + " FROM schedules WHERE NOT paused ORDER BY id")
+}
+
+// SetPaused pauses or resumes a schedule in a channel. Resuming restarts the
+// schedule from now rather than catching up on drops missed while paused.
+func SetPaused(channelID int64, id int64, paused bool) error {
+	if paused {
+		return execSchedule("UPDATE schedules SET paused = true WHERE channel_id = $1 AND id = $2", channelID, id)
+	}
+	return execSchedule("UPDATE schedules SET paused = false, last_run = $3 WHERE channel_id = $1 AND id = $2", channelID, id, time.Now().UnixMilli())
+}
+
+func RemoveSchedule(channelID int64, id int64) error {
+	return execSchedule("DELETE FROM schedules WHERE channel_id = $1 AND id = $2", channelID, id)
+}
+
+// MarkRun records that a schedule fired at the given time.
+func MarkRun(id int64, at time.Time) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(), "UPDATE schedules SET last_run = $2 WHERE id = $1", id, at.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("error updating schedule: %v", err)
+	}
+	return nil
+}
+
+// GetTimezone returns the IANA timezone schedules in a channel are shown and
+// evaluated in, defaulting to UTC.
+func GetTimezone(channelID int64) (*time.Location, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	var name string
+	err = dbpool.QueryRow(context.Background(), "SELECT timezone FROM channel_timezones WHERE channel_id = $1", channelID).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.UTC, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying timezone: %v", err)
+	}
+	return time.LoadLocation(name)
+}
+
+func SetTimezone(channelID int64, name string) error {
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Errorf("unknown timezone %s", name)
+	}
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(),
+		"INSERT INTO channel_timezones (channel_id, timezone) VALUES ($1, $2) ON CONFLICT (channel_id) DO UPDATE SET timezone = EXCLUDED.timezone",
+		channelID, name)
+	if err != nil {
+		return fmt.Errorf("error saving timezone: %v", err)
+	}
+	return nil
+}
+
+func execSchedule(query string, channelID int64, id int64, args ...any) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	a, err := dbpool.Exec(context.Background(), query, append([]any{channelID, id}, args...)...)
+	if err != nil {
+		return fmt.Errorf("error updating schedule: %v", err)
+	}
+	if a.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func querySchedules(query string, args ...any) (ScheduleItems, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	rows, err := dbpool.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying schedules: %v", err)
+	}
+	defer rows.Close()
+
+	var items ScheduleItems
+	for rows.Next() {
+		var item ScheduleItem
+		var lastRun int64
+		if err := rows.Scan(&item.ID, &item.GuildID, &item.ChannelID, &item.CreatorID, &item.Cron, &item.Provider, &item.Query, &item.Paused, &lastRun); err != nil {
+			return nil, fmt.Errorf("error scanning schedule: %v", err)
+		}
+		item.LastRun = time.UnixMilli(lastRun)
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,139 @@
+-- Reference schema for the tables the bot reads and writes.
+-- Apply against the database referenced by DATABASE_URL.
+
+CREATE TABLE IF NOT EXISTS sent_items (
+    url TEXT NOT NULL,
+    ts  BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS preferences (
+    id         SERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL,
+    preference TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS aliases (
+    scope     TEXT NOT NULL,
+    owner_id  BIGINT NOT NULL,
+    name      TEXT NOT NULL,
+    expansion TEXT NOT NULL,
+    PRIMARY KEY (scope, owner_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS media_posts (
+    id           SERIAL PRIMARY KEY,
+    message_id   BIGINT NOT NULL,
+    channel_id   BIGINT NOT NULL,
+    requester_id BIGINT NOT NULL,
+    provider     TEXT NOT NULL,
+    content_id   TEXT NOT NULL,
+    url          TEXT NOT NULL,
+    tags         TEXT NOT NULL,
+    query        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS media_posts_message_id ON media_posts (message_id);
+
+CREATE TABLE IF NOT EXISTS media_feedback (
+    user_id    BIGINT NOT NULL,
+    message_id BIGINT NOT NULL,
+    value      SMALLINT NOT NULL,
+    PRIMARY KEY (user_id, message_id, value)
+);
+
+CREATE TABLE IF NOT EXISTS tag_affinity (
+    user_id BIGINT NOT NULL,
+    tag     TEXT NOT NULL,
+    score   INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, tag)
+);
+
+CREATE TABLE IF NOT EXISTS favorites (
+    id         SERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL,
+    provider   TEXT NOT NULL,
+    content_id TEXT NOT NULL,
+    url        TEXT NOT NULL,
+    tags       TEXT NOT NULL,
+    ts         BIGINT NOT NULL,
+    UNIQUE (user_id, provider, content_id)
+);
+
+CREATE TABLE IF NOT EXISTS schedules (
+    id         SERIAL PRIMARY KEY,
+    guild_id   BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    creator_id BIGINT NOT NULL,
+    cron       TEXT NOT NULL,
+    provider   TEXT NOT NULL,
+    query      TEXT NOT NULL,
+    paused     BOOLEAN NOT NULL DEFAULT false,
+    last_run   BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS channel_timezones (
+    channel_id BIGINT PRIMARY KEY,
+    timezone   TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id           SERIAL PRIMARY KEY,
+    guild_id     BIGINT NOT NULL,
+    channel_id   BIGINT NOT NULL,
+    creator_id   BIGINT NOT NULL,
+    provider     TEXT NOT NULL,
+    query        TEXT NOT NULL,
+    last_seen_id BIGINT NOT NULL,
+    ts           BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS last_queries (
+    user_id     BIGINT PRIMARY KEY,
+    provider    TEXT NOT NULL,
+    search_term TEXT NOT NULL,
+    page        INTEGER NOT NULL DEFAULT 0,
+    ts          BIGINT NOT NULL
+);
+ALTER TABLE last_queries ADD COLUMN IF NOT EXISTS query TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS search_cache (
+    key     TEXT PRIMARY KEY,
+    payload JSONB NOT NULL,
+    expires BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS scene_requests (
+    id         SERIAL PRIMARY KEY,
+    foreign_id TEXT NOT NULL,
+    title      TEXT NOT NULL DEFAULT '',
+    outcome    TEXT NOT NULL,
+    guild_id   BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    message_id BIGINT NOT NULL,
+    user_id    BIGINT NOT NULL,
+    quality_profile_id INTEGER NOT NULL DEFAULT 0,
+    root_folder        TEXT NOT NULL DEFAULT '',
+    tags               INTEGER[] NOT NULL DEFAULT '{}',
+    notified   BOOLEAN NOT NULL DEFAULT false,
+    ts         BIGINT NOT NULL
+);
+-- columns added after scene_requests was first created; requests from before
+-- had been added and were waiting to be announced
+ALTER TABLE scene_requests ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
+ALTER TABLE scene_requests ADD COLUMN IF NOT EXISTS outcome TEXT NOT NULL DEFAULT 'added';
+ALTER TABLE scene_requests ADD COLUMN IF NOT EXISTS quality_profile_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scene_requests ADD COLUMN IF NOT EXISTS root_folder TEXT NOT NULL DEFAULT '';
+ALTER TABLE scene_requests ADD COLUMN IF NOT EXISTS tags INTEGER[] NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS scene_requests_foreign_id ON scene_requests (foreign_id);
+CREATE INDEX IF NOT EXISTS scene_requests_user_id ON scene_requests (user_id);
+
+CREATE TABLE IF NOT EXISTS whisparr_jobs (
+    id         SERIAL PRIMARY KEY,
+    request_id INTEGER NOT NULL REFERENCES scene_requests (id) ON DELETE CASCADE,
+    kind       TEXT NOT NULL,
+    status     TEXT NOT NULL,
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_run   BIGINT NOT NULL,
+    ts         BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS whisparr_jobs_due ON whisparr_jobs (status, next_run);
@@ -0,0 +1,120 @@
+package searchcache
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"kannonfoundry/whutbot3/api"
+)
+
+// maxMemoryEntries is how many entries the in-memory cache holds before
+// expired ones are swept out.
+const maxMemoryEntries = 1000
+
+// Entry is a cached search result.
+type Entry struct {
+	Files []api.Media
+	// Relaxed are the tags that had to be dropped to get any results.
+	Relaxed []string
+	Expires time.Time
+}
+
+// Cache holds search results for a while so repeated requests for the same
+// query can be served without calling the provider again. Entries are kept in
+// memory and, when persist is set, in Postgres so they survive restarts.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	ttl     time.Duration
+	persist bool
+}
+
+func New(ttl time.Duration, persist bool) *Cache {
+	return &Cache{entries: map[string]Entry{}, ttl: ttl, persist: persist}
+}
+
+// Key normalizes a query so the same tags in any order or case share an entry.
+func Key(provider string, tags []string, page int) string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		normalized = append(normalized, strings.ToLower(tag))
+	}
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	return fmt.Sprintf("%s|%d|%s", provider, page, strings.Join(normalized, " "))
+}
+
+// Get returns the unexpired entry for key, if there is one.
+func (c *Cache) Get(key string) (Entry, bool) {
+	if c.ttl <= 0 {
+		return Entry{}, false
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.Expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok || !c.persist {
+		return entry, ok
+	}
+
+	entry, ok, err := getEntry(key)
+	if err != nil {
+		log.Printf("failed to read search cache: %v", err)
+		return Entry{}, false
+	}
+	if ok {
+		c.mu.Lock()
+		c.entries[key] = entry
+		c.mu.Unlock()
+	}
+	return entry, ok
+}
+
+// Put caches files and relaxed for the cache's TTL.
+func (c *Cache) Put(key string, files []api.Media, relaxed []string) {
+	if c.ttl <= 0 {
+		return
+	}
+	entry := Entry{Files: files, Relaxed: relaxed, Expires: time.Now().Add(c.ttl)}
+	c.mu.Lock()
+	if len(c.entries) >= maxMemoryEntries {
+		c.sweep()
+	}
+	c.entries[key] = entry
+	c.mu.Unlock()
+	if c.persist {
+		if err := putEntry(key, entry); err != nil {
+			log.Printf("failed to write search cache: %v", err)
+		}
+	}
+}
+
+// Invalidate drops the entry for key, when every result in it was sent or
+// refreshing it failed.
+func (c *Cache) Invalidate(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+	if c.persist {
+		if err := deleteEntry(key); err != nil {
+			log.Printf("failed to delete from search cache: %v", err)
+		}
+	}
+}
+
+// sweep removes expired entries; the caller must hold c.mu.
+func (c *Cache) sweep() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.Expires) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package searchcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func getEntry(key string) (Entry, bool, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	var payload []byte
+	err = dbpool.QueryRow(context.Background(),
+		"SELECT payload FROM search_cache WHERE key = $1 AND expires > $2", key, time.Now().UnixMilli()).Scan(&payload)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("error querying search cache: %v", err)
+	}
+	var entry Entry
+	if err := json.Unmarshal(payload, &entry); err != nil {
+		return Entry{}, false, fmt.Errorf("error decoding search cache: %v", err)
+	}
+	return entry, true, nil
+}
+
+func putEntry(key string, entry Entry) error {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	// Begin a transaction
+	tx, err := dbpool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), "DELETE FROM search_cache WHERE expires <= $1", time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("error pruning search cache: %v", err)
+	}
+	_, err = tx.Exec(context.Background(),
+		"INSERT INTO search_cache (key, payload, expires) VALUES ($1, $2, $3) ON CONFLICT (key) DO UPDATE SET payload = EXCLUDED.payload, expires = EXCLUDED.expires",
+		key, payload, entry.Expires.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("error saving search cache: %v", err)
+	}
+	return tx.Commit(context.Background())
+}
+
+func deleteEntry(key string) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(), "DELETE FROM search_cache WHERE key = $1", key)
+	if err != nil {
+		return fmt.Errorf("error deleting from search cache: %v", err)
+	}
+	return nil
+}
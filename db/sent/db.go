@@ -64,6 +64,17 @@ func (instance *SentDB) MarkAsSent(url string) error {
 	return tx.Commit(context.Background())
 }
 
+// UnmarkSent forgets that url was sent, for files that were picked but
+// couldn't be posted after all.
+func (instance *SentDB) UnmarkSent(url string) error {
+	_, err := instance.pool.Exec(context.Background(), "DELETE FROM sent_items WHERE url = $1", url)
+	if err != nil {
+		return fmt.Errorf("error unmarking sent item: %v", err)
+	}
+	instance.items = nil // reset cache
+	return nil
+}
+
 func (instance *SentDB) querySentItems() ([]SentItem, error) {
 	rows, err := instance.pool.Query(context.Background(), "SELECT url FROM sent_items order by ts DESC LIMIT 50")
 	if err != nil {
@@ -0,0 +1,116 @@
+package subscriptions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotFound = errors.New("no subscription with that ID in this channel")
+
+// SubscriptionItem is a query a channel follows. LastSeenID is the cursor:
+// only posts with a higher ID are posted on the next poll.
+type SubscriptionItem struct {
+	ID         int64
+	GuildID    int64
+	ChannelID  int64
+	CreatorID  int64
+	Provider   string
+	Query      string
+	LastSeenID int64
+}
+type SubscriptionItems []SubscriptionItem
+
+const subscriptionColumns = "id, guild_id, channel_id, creator_id, provider, query, last_seen_id"
+
+func AddSubscription(item SubscriptionItem) (int64, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	var id int64
+	err = dbpool.QueryRow(context.Background(),
+		"INSERT INTO subscriptions (guild_id, channel_id, creator_id, provider, query, last_seen_id, ts) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		item.GuildID, item.ChannelID, item.CreatorID, item.Provider, item.Query, item.LastSeenID, time.Now().UnixMilli()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error saving subscription: %v", err)
+	}
+	return id, nil
+}
+
+// GetSubscriptions returns the subscriptions posting to a channel, or every
+// subscription when channelID is 0.
+func GetSubscriptions(channelID int64) (SubscriptionItems, error) {
+	if channelID == 0 {
+		return querySubscriptions("SELECT " + subscriptionColumns + " FROM subscriptions ORDER BY id")
+	}
+	return querySubscriptions("SELECT "+subscriptionColumns+" FROM subscriptions WHERE channel_id = $1 ORDER BY id", channelID)
+}
+
+func RemoveSubscription(channelID int64, id int64) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	a, err := dbpool.Exec(context.Background(), "DELETE FROM subscriptions WHERE channel_id = $1 AND id = $2", channelID, id)
+	if err != nil {
+		return fmt.Errorf("error deleting subscription: %v", err)
+	}
+	if a.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AdvanceCursor moves a subscription's cursor forward to lastSeenID. It never
+// moves it backwards.
+func AdvanceCursor(id int64, lastSeenID int64) error {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	_, err = dbpool.Exec(context.Background(),
+		"UPDATE subscriptions SET last_seen_id = GREATEST(last_seen_id, $2) WHERE id = $1", id, lastSeenID)
+	if err != nil {
+		return fmt.Errorf("error updating subscription: %v", err)
+	}
+	return nil
+}
+
+func querySubscriptions(query string, args ...any) (SubscriptionItems, error) {
+
+	dbpool, err := pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to database: %v", err)
+	}
+	defer dbpool.Close()
+
+	rows, err := dbpool.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	var items SubscriptionItems
+	for rows.Next() {
+		var item SubscriptionItem
+		if err := rows.Scan(&item.ID, &item.GuildID, &item.ChannelID, &item.CreatorID, &item.Provider, &item.Query, &item.LastSeenID); err != nil {
+			return nil, fmt.Errorf("error scanning subscription: %v", err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,60 @@
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+)
+
+// Distance returns the Levenshtein edit distance between a and b.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// Closest returns up to limit candidates ordered by their distance to term.
+// Candidates further away than a third of the term's length (minimum 2) are
+// dropped so wildly different names are never suggested.
+func Closest(term string, candidates []string, limit int) []string {
+	term = strings.ToLower(term)
+	maxDistance := max(2, len([]rune(term))/3)
+
+	type match struct {
+		name     string
+		distance int
+	}
+	var matches []match
+	for _, c := range candidates {
+		d := Distance(term, strings.ToLower(c))
+		if d <= maxDistance {
+			matches = append(matches, match{name: c, distance: d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	var results []string
+	for _, m := range matches {
+		if len(results) == limit {
+			break
+		}
+		results = append(results, m.name)
+	}
+	return results
+}
@@ -0,0 +1,52 @@
+package fuzzy
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"same", "same", 0},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"café", "cafe", 1},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestClosest(t *testing.T) {
+	tests := []struct {
+		name       string
+		term       string
+		candidates []string
+		limit      int
+		want       []string
+	}{
+		// short terms still allow two edits, but no more
+		{"short term", "cat", []string{"dog", "cot", "cattle", "cart", "cat"}, 5, []string{"cat", "cot", "cart"}},
+		// 8 letters allow 8/3 = 2 edits; ties keep the candidates' order
+		{"a third of the term", "brunette", []string{"brune", "brunet", "brunettes", "Brunete"}, 5, []string{"brunettes", "Brunete", "brunet"}},
+		// 12 letters allow 4 edits
+		{"long term", "Masturbation", []string{"masterbation", "masturbate", "master"}, 5, []string{"masterbation", "masturbate"}},
+		{"ignores case", "BLONDE", []string{"Blonde"}, 5, []string{"Blonde"}},
+		{"limit", "cat", []string{"cot", "cut", "cat"}, 2, []string{"cat", "cot"}},
+		{"nothing close", "cat", []string{"elephant", "giraffe"}, 5, nil},
+		{"no candidates", "cat", nil, 5, nil},
+	}
+	for _, tt := range tests {
+		if got := Closest(tt.term, tt.candidates, tt.limit); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Closest(%q, %q, %d) = %q, want %q", tt.name, tt.term, tt.candidates, tt.limit, got, tt.want)
+		}
+	}
+}
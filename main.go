@@ -25,15 +25,23 @@ func main() {
 		log.Fatalf("error creating Discord session: %v", err)
 	}
 
-	// Request the guild message and message content intents so we can read messages
-	dg.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsMessageContent
+	// Request the guild message and message content intents so we can read messages,
+	// and reactions so we can learn from feedback on media posts
+	dg.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsMessageContent | discordgo.IntentsGuildMessageReactions
 
+	// build the handlers once so state like rate limits lasts between messages;
+	// the stash handler is shared so there's a single Whisparr tag cache
+	stash := messages.NewStashHandler(cfg)
+	dispatchMessage := messages.DispatchMessageByChannel(messages.DefaultHandlers(cfg, stash))
 	dg.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
 		if m.Author == nil || m.Author.Bot {
 			return
 		}
-		messages.DispatchMessageByChannel(messages.DefaultHandlers(cfg))(s, m)
+		dispatchMessage(s, m)
 	})
+	dg.AddHandler(messages.HandleMediaReactionAdd)
+	dg.AddHandler(messages.HandleMediaReactionRemove)
+	dg.AddHandler(messages.DispatchInteraction(messages.DefaultInteractionHandlers(cfg, stash)))
 
 	dg.ChannelMessageSend(cfg.LogChannelID, "WhutBot is now running and listening")
 
@@ -43,6 +51,13 @@ func main() {
 	}
 	defer dg.Close()
 
+	stopWorkers := make(chan struct{})
+	defer close(stopWorkers)
+	messages.StartScheduler(dg, stopWorkers)
+	messages.StartSubscriptionPoller(dg, cfg, stopWorkers)
+	messages.StartWebhookServer(dg, cfg, stopWorkers)
+	messages.StartRetryWorker(dg, stash, stopWorkers)
+
 	log.Println("Bot is now running. Press CTRL-C to exit.")
 
 	stop := make(chan os.Signal, 1)
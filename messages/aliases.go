@@ -0,0 +1,73 @@
+package messages
+
+import (
+	"fmt"
+	"strings"
+
+	"kannonfoundry/whutbot3/db/aliases"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const aliasHelp = "Available alias commands: set <name> <tags...>, remove <name>, list, guild set <name> <tags...>, guild remove <name>, guild list"
+
+func handleAliasCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) {
+	scope := aliases.UserScope
+	ownerID := parseSnowflake(m.Author.ID)
+	command, arguments := parseCommand(args)
+	if command == "guild" {
+		if m.GuildID == "" {
+			s.ChannelMessageSend(m.ChannelID, "Guild aliases can only be used in a server")
+			return
+		}
+		scope = aliases.GuildScope
+		ownerID = parseSnowflake(m.GuildID)
+		command, arguments = parseCommand(arguments)
+		if command != "list" && !isModerator(s, m.Author.ID, m.ChannelID) {
+			s.ChannelMessageSend(m.ChannelID, "Only moderators can change guild aliases")
+			return
+		}
+	}
+
+	var err error
+	switch command {
+	case "set":
+		name, expansion := parseCommand(arguments)
+		if err = validateAliasName(name); err == nil {
+			if len(strings.Fields(expansion)) == 0 {
+				err = fmt.Errorf("alias %s needs at least one tag", name)
+			} else if err = aliases.SetAlias(scope, ownerID, name, strings.Fields(expansion)); err == nil {
+				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Alias %s saved", name))
+			}
+		}
+	case "remove":
+		name := strings.TrimSpace(arguments)
+		if err = aliases.RemoveAlias(scope, ownerID, name); err == nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Alias %s removed", name))
+		}
+	case "list":
+		var items aliases.AliasItems
+		if items, err = aliases.GetAliases(scope, ownerID); err == nil {
+			if len(items) == 0 {
+				s.ChannelMessageSend(m.ChannelID, "No aliases set")
+			} else {
+				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Aliases:\n%s", items.String()))
+			}
+		}
+	default:
+		s.ChannelMessageSend(m.ChannelID, aliasHelp)
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error handling aliases: %v", err))
+	}
+}
+
+func validateAliasName(name string) error {
+	if name == "" {
+		return fmt.Errorf("alias name is required")
+	}
+	if strings.HasPrefix(name, "-") || strings.Contains(name, ":") {
+		return fmt.Errorf("alias name %s can't start with - or contain :", name)
+	}
+	return nil
+}
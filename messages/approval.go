@@ -0,0 +1,140 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+
+	"kannonfoundry/whutbot3/api/whisparr"
+	"kannonfoundry/whutbot3/db/requests"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	stashApproveID = StashComponentPrefix + ":approve"
+	stashRejectID  = StashComponentPrefix + ":reject"
+)
+
+// needsApproval reports whether the request has to wait for an approver.
+func (h *StashHandler) needsApproval(s *discordgo.Session, req linkRequest) bool {
+	return h.ApprovalMode && !h.isApprover(s, req.User.ID, req.ChannelID, req.Member)
+}
+
+// isApprover reports whether the user has the approver role, or is a Whispar
+// admin when no approver role is configured.
+func (h *StashHandler) isApprover(s *discordgo.Session, userID string, channelID string, member *discordgo.Member) bool {
+	if h.ApproverRoleID == "" {
+		return h.isWhisparrAdmin(s, userID, channelID, member)
+	}
+	return member != nil && slices.Contains(member.Roles, h.ApproverRoleID)
+}
+
+// postApprovalRequest shows approvers the scene with buttons to approve or
+// reject the request.
+func (h *StashHandler) postApprovalRequest(ctx context.Context, s *discordgo.Session, req linkRequest, requestID int64, movie whisparr.Movie) error {
+	id := strconv.FormatInt(requestID, 10)
+	msg := &discordgo.MessageSend{
+		Content: fmt.Sprintf("<@%s> would like this added:", req.User.ID),
+		Embeds:  []*discordgo.MessageEmbed{h.sceneEmbed(ctx, movie)},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Approve", Style: discordgo.SuccessButton, CustomID: stashApproveID + "|" + id, Emoji: &discordgo.ComponentEmoji{Name: "✅"}},
+				discordgo.Button{Label: "Reject", Style: discordgo.DangerButton, CustomID: stashRejectID + "|" + id, Emoji: &discordgo.ComponentEmoji{Name: "✖️"}},
+			}},
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	channelID := req.ChannelID
+	if h.ApprovalChannelID != "" {
+		channelID = h.ApprovalChannelID
+	} else {
+		msg.Reference = &discordgo.MessageReference{MessageID: req.MessageID, ChannelID: req.ChannelID, GuildID: req.GuildID}
+	}
+	_, err := s.ChannelMessageSendComplex(channelID, msg)
+	return err
+}
+
+// handleApprovalInteraction handles the Approve and Reject buttons on a held
+// request. Only approvers may use them, and the requester is told the outcome.
+func (h *StashHandler) handleApprovalInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, action string, args []string) {
+	approver := interactionUser(i)
+	if !h.isApprover(s, approver.ID, i.ChannelID, i.Member) {
+		respondEphemeral(s, i, "Only approvers can do that.")
+		return
+	}
+	if len(args) == 0 {
+		respondEphemeral(s, i, "That request is broken.")
+		return
+	}
+	requestID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		respondEphemeral(s, i, "That request is broken.")
+		return
+	}
+	item, err := requests.GetRequest(requestID)
+	if errors.Is(err, requests.ErrNotFound) {
+		respondEphemeral(s, i, "That request no longer exists.")
+		return
+	}
+	if err != nil {
+		log.Printf("failed to get request %d: %v", requestID, err)
+		respondEphemeral(s, i, "Couldn't find that request.")
+		return
+	}
+
+	if action == stashRejectID {
+		claimed, err := requests.ClaimRequest(item.ID, requests.OutcomeAwaiting, requests.OutcomeRejected)
+		if err != nil || !claimed {
+			respondEphemeral(s, i, "That request has already been handled.")
+			return
+		}
+		log.Printf("%s rejected request %d", approver.Username, item.ID)
+		updatePreview(s, i, fmt.Sprintf("✖️ Rejected by <@%s>.", approver.ID))
+		notifyRequester(s, item, "your request was rejected.")
+		return
+	}
+
+	claimed, err := requests.ClaimRequest(item.ID, requests.OutcomeAwaiting, requests.OutcomeAdding)
+	if err != nil || !claimed {
+		respondEphemeral(s, i, "That request has already been handled.")
+		return
+	}
+	log.Printf("%s approved request %d", approver.Username, item.ID)
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	if err != nil {
+		log.Printf("failed to acknowledge interaction: %v", err)
+	}
+	result := h.addRequestedScene(context.Background(), s, item)
+	content := fmt.Sprintf("%s\nApproved by <@%s>.", result.String(), approver.ID)
+	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:    &content,
+		Components: &[]discordgo.MessageComponent{},
+	}); err != nil {
+		log.Printf("failed to update approval request: %v", err)
+	}
+	notifyRequester(s, item, "your request was approved: "+result.String())
+}
+
+// notifyRequester replies to the message a request was made in, mentioning
+// the requester.
+func notifyRequester(s *discordgo.Session, item requests.RequestItem, msg string) {
+	channelID := strconv.FormatInt(item.ChannelID, 10)
+	userID := strconv.FormatInt(item.UserID, 10)
+	_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("<@%s> %s", userID, msg),
+		Reference: &discordgo.MessageReference{
+			MessageID:       strconv.FormatInt(item.MessageID, 10),
+			ChannelID:       channelID,
+			GuildID:         strconv.FormatInt(item.GuildID, 10),
+			FailIfNotExists: new(bool),
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{userID}},
+	})
+	if err != nil {
+		log.Printf("failed to notify requester of request %d: %v", item.ID, err)
+	}
+}
@@ -0,0 +1,61 @@
+package messages
+
+import (
+	"sync"
+	"time"
+
+	"kannonfoundry/whutbot3/api"
+	"kannonfoundry/whutbot3/config"
+	"kannonfoundry/whutbot3/db/searchcache"
+)
+
+var (
+	searchCacheOnce sync.Once
+	searchCache     *searchcache.Cache
+)
+
+func resultsCache() *searchcache.Cache {
+	searchCacheOnce.Do(func() {
+		cfg := config.Default()
+		searchCache = searchcache.New(time.Duration(cfg.SearchCacheMinutes)*time.Minute, cfg.SearchCachePersist)
+	})
+	return searchCache
+}
+
+// cachedSearch returns cached results for the search when there are any, and
+// otherwise runs it (relaxing preferences if needed) and caches what it finds.
+// refresh skips the cache lookup, for when the cached results have all been
+// sent. cached reports whether the results came from the cache.
+func cachedSearch(searchClient api.MediaSearcher, provider string, userTags []string, searchTags []string, refresh bool) (files []api.Media, relaxed []string, cached bool, err error) {
+	key := searchcache.Key(provider, searchTags, 0)
+	if !refresh {
+		if entry, ok := resultsCache().Get(key); ok {
+			return entry.Files, entry.Relaxed, true, nil
+		}
+	}
+	files, relaxed, err = searchWithRelaxation(searchClient, userTags, searchTags)
+	if err != nil {
+		resultsCache().Invalidate(key)
+		return nil, nil, false, err
+	}
+	resultsCache().Put(key, files, relaxed)
+	return files, relaxed, false, nil
+}
+
+// cachedPage returns a page of results, from the cache when possible.
+func cachedPage(searcher api.PagedSearcher, provider string, tags []string, page int) ([]api.Media, error) {
+	key := searchcache.Key(provider, tags, page)
+	if entry, ok := resultsCache().Get(key); ok {
+		return entry.Files, nil
+	}
+	files, err := searcher.SearchPage(tags, page)
+	if err == nil && len(files) > 0 {
+		resultsCache().Put(key, files, nil)
+	}
+	return files, err
+}
+
+// invalidatePage drops a cached page, once every result on it was sent.
+func invalidatePage(provider string, tags []string, page int) {
+	resultsCache().Invalidate(searchcache.Key(provider, tags, page))
+}
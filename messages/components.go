@@ -0,0 +1,220 @@
+package messages
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"kannonfoundry/whutbot3/db/posts"
+	prefs "kannonfoundry/whutbot3/db/preferences"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// MediaComponentPrefix prefixes the custom ID of every component on a media result.
+const MediaComponentPrefix = "media"
+
+const (
+	mediaAnotherID        = MediaComponentPrefix + ":another"
+	mediaBlockID          = MediaComponentPrefix + ":block"
+	mediaBlockSelectID    = MediaComponentPrefix + ":blockselect"
+	mediaDeleteID         = MediaComponentPrefix + ":delete"
+	mediaFavoriteID       = MediaComponentPrefix + ":favorite"
+	mediaFavoriteSelectID = MediaComponentPrefix + ":favselect"
+)
+
+// maxSelectOptions is Discord's limit on options in a select menu.
+const maxSelectOptions = 25
+
+// resultComponents returns the buttons on a media result. "Another" is left
+// off results that have no query to search again, like reposted favorites.
+func resultComponents(repeatable bool) []discordgo.MessageComponent {
+	var buttons []discordgo.MessageComponent
+	if repeatable {
+		buttons = append(buttons, discordgo.Button{Label: "Another", Style: discordgo.PrimaryButton, CustomID: mediaAnotherID, Emoji: &discordgo.ComponentEmoji{Name: "🔁"}})
+	}
+	buttons = append(buttons,
+		discordgo.Button{Label: "Block a tag", Style: discordgo.SecondaryButton, CustomID: mediaBlockID, Emoji: &discordgo.ComponentEmoji{Name: "🚫"}},
+		discordgo.Button{Label: "Favorite", Style: discordgo.SecondaryButton, CustomID: mediaFavoriteID, Emoji: &discordgo.ComponentEmoji{Name: "⭐"}},
+		discordgo.Button{Label: "Delete", Style: discordgo.DangerButton, CustomID: mediaDeleteID, Emoji: &discordgo.ComponentEmoji{Name: "🗑️"}},
+	)
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+// HandleMediaInteraction handles the buttons and menus on media results. Anyone
+// may favorite a result; only the user who requested it, or a moderator, may
+// use the rest.
+func HandleMediaInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.MessageComponentData()
+	action, messageID, _ := strings.Cut(data.CustomID, "|")
+	if messageID == "" {
+		messageID = i.Message.ID
+	}
+
+	items, err := posts.GetPosts(parseSnowflake(messageID))
+	if err != nil {
+		log.Printf("failed to get posts for %s: %v", messageID, err)
+		respondEphemeral(s, i, "Couldn't find what that post was.")
+		return
+	}
+	if len(items) == 0 {
+		respondEphemeral(s, i, "That post is too old to interact with.")
+		return
+	}
+
+	user := interactionUser(i)
+	switch action {
+	case mediaFavoriteID:
+		handleFavoriteInteraction(s, i, messageID, user, items)
+		return
+	case mediaFavoriteSelectID:
+		handleFavoriteSelectInteraction(s, i, user, items, data.Values)
+		return
+	}
+	if parseSnowflake(user.ID) != items[0].RequesterID && !interactionIsModerator(i) {
+		respondEphemeral(s, i, "Only the requester or a moderator can do that.")
+		return
+	}
+
+	// moderators act on the requester's behalf, so searches and blocks use the
+	// requester's preferences rather than the moderator's
+	requesterID := items[0].RequesterID
+	switch action {
+	case mediaAnotherID:
+		requester := user
+		if parseSnowflake(user.ID) != requesterID {
+			requester = lookupUser(s, requesterID)
+		}
+		handleAnotherInteraction(s, i, requester, items)
+	case mediaBlockID:
+		handleBlockInteraction(s, i, messageID, items, parseSnowflake(user.ID) == requesterID)
+	case mediaBlockSelectID:
+		handleBlockSelectInteraction(s, i, requesterID, data.Values)
+	case mediaDeleteID:
+		handleDeleteInteraction(s, i, messageID)
+	}
+}
+
+// handleAnotherInteraction posts another result for the post's query, searched
+// as the requester.
+func handleAnotherInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, requester *discordgo.User, items posts.PostItems) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	if err != nil {
+		log.Printf("failed to acknowledge interaction: %v", err)
+	}
+	postMedia(s, mediaRequest{
+		ChannelID: i.ChannelID,
+		GuildID:   i.GuildID,
+		Author:    requester,
+		Provider:  items[0].Provider,
+		Count:     1,
+		Query:     items[0].Query,
+
+		RememberQuery: true,
+	})
+}
+
+// handleBlockInteraction offers the post's tags to add to the requester's
+// exclusions. own is whether the requester is the one asking.
+func handleBlockInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, messageID string, items posts.PostItems, own bool) {
+	tags := items.Tags()
+	if len(tags) == 0 {
+		respondEphemeral(s, i, "That post has no tags to block.")
+		return
+	}
+	if len(tags) > maxSelectOptions {
+		tags = tags[:maxSelectOptions]
+	}
+	var options []discordgo.SelectMenuOption
+	for _, tag := range tags {
+		options = append(options, discordgo.SelectMenuOption{Label: tag, Value: tag})
+	}
+	content := "Pick the tags to exclude from your searches:"
+	if !own {
+		content = fmt.Sprintf("Pick the tags to exclude from <@%d>'s searches:", items[0].RequesterID)
+	}
+	minValues := 1
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.SelectMenu{
+						// the menu lives on its own message, so carry the result's ID along
+						CustomID:    mediaBlockSelectID + "|" + messageID,
+						Placeholder: "Tags to block",
+						MinValues:   &minValues,
+						MaxValues:   len(options),
+						Options:     options,
+					},
+				}},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("failed to respond to interaction: %v", err)
+	}
+}
+
+// handleBlockSelectInteraction adds the picked tags to the requester's exclusions.
+func handleBlockSelectInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, requesterID int64, tags []string) {
+	var exclusions []string
+	for _, tag := range tags {
+		exclusions = append(exclusions, "-"+tag)
+	}
+	if err := prefs.AddPreferences(requesterID, exclusions); err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("Error handling preferences: %v", err))
+		return
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    fmt.Sprintf("Blocked: %s", strings.Join(exclusions, " ")),
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Printf("failed to respond to interaction: %v", err)
+	}
+}
+
+func handleDeleteInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, messageID string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	if err != nil {
+		log.Printf("failed to acknowledge interaction: %v", err)
+	}
+	if err := s.ChannelMessageDelete(i.ChannelID, messageID); err != nil {
+		log.Printf("failed to delete message %s: %v", messageID, err)
+		return
+	}
+	if err := posts.DeletePosts(parseSnowflake(messageID)); err != nil {
+		log.Printf("failed to delete posts for %s: %v", messageID, err)
+	}
+}
+
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Printf("failed to respond to interaction: %v", err)
+	}
+}
+
+// interactionUser returns who triggered the interaction, in a guild or a DM.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+func interactionIsModerator(i *discordgo.InteractionCreate) bool {
+	return i.Member != nil && i.Member.Permissions&discordgo.PermissionManageMessages != 0
+}
@@ -0,0 +1,73 @@
+package messages
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// embedTagCount is how many of a post's tags are shown in its embed.
+const embedTagCount = 12
+
+// resultMessage builds a message attaching each uploadable file in the batch
+// with an embed describing every result.
+func resultMessage(batch []downloadedFile, rc resultContext) *discordgo.MessageSend {
+	msg := &discordgo.MessageSend{}
+	for _, file := range batch {
+		if !file.tooLarge() {
+			msg.Files = append(msg.Files, &discordgo.File{Name: file.Name, Reader: bytes.NewReader(file.Data)})
+		}
+		msg.Embeds = append(msg.Embeds, resultEmbed(file, rc))
+	}
+	msg.Components = resultComponents(!rc.Request.NoRepeat)
+	return msg
+}
+
+func resultEmbed(file downloadedFile, rc resultContext) *discordgo.MessageEmbed {
+	media := file.Media
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("%s #%s", media.Provider, media.ID),
+		URL:   media.PostURL,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Score", Value: fmt.Sprintf("%d", media.Score), Inline: true},
+		},
+	}
+	if media.Width > 0 && media.Height > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: "Size", Value: fmt.Sprintf("%d×%d", media.Width, media.Height), Inline: true,
+		})
+	}
+	if len(media.Tags) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Tags", Value: shortTagList(media.Tags)})
+	}
+	if rc.SearchTerm != "" {
+		embed.Description = fmt.Sprintf("Search: `%s`", rc.SearchTerm)
+	}
+	if file.tooLarge() {
+		embed.Description = strings.TrimSpace(embed.Description + "\nThe booty too big 🥵 — too large to upload here, tap the title to view the original.")
+		if media.PostURL == "" {
+			embed.URL = media.URL
+		}
+	}
+	if requester := rc.Request.Author; requester != nil {
+		embed.Footer = &discordgo.MessageEmbedFooter{
+			Text:    "Requested by " + requester.Username,
+			IconURL: requester.AvatarURL(""),
+		}
+	}
+	return embed
+}
+
+func shortTagList(tags []string) string {
+	shown := tags
+	if len(shown) > embedTagCount {
+		shown = shown[:embedTagCount]
+	}
+	list := "`" + strings.Join(shown, "` `") + "`"
+	if extra := len(tags) - len(shown); extra > 0 {
+		list += fmt.Sprintf(" +%d more", extra)
+	}
+	return list
+}
@@ -0,0 +1,214 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"kannonfoundry/whutbot3/api"
+	"kannonfoundry/whutbot3/db/favorites"
+	"kannonfoundry/whutbot3/db/posts"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// favoritesPageSize is how many favorites "favs list" shows per page.
+const favoritesPageSize = 10
+
+const favsHelp = "Available favs commands: list [page], show <n>, remove <n>"
+
+func handleFavsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) {
+	command, arguments := parseCommand(args)
+	userID := parseSnowflake(m.Author.ID)
+	var err error
+	switch command {
+	case "list", "":
+		page := 1
+		if arguments != "" {
+			if page, err = strconv.Atoi(strings.TrimSpace(arguments)); err != nil || page < 1 {
+				s.ChannelMessageSend(m.ChannelID, "Page must be a positive number")
+				return
+			}
+		}
+		err = listFavorites(s, m, userID, page)
+	case "show":
+		var n int
+		if n, err = strconv.Atoi(strings.TrimSpace(arguments)); err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Usage: favs show <n>")
+			return
+		}
+		err = showFavorite(s, m, userID, n)
+	case "remove":
+		var n int
+		if n, err = strconv.Atoi(strings.TrimSpace(arguments)); err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Usage: favs remove <n>")
+			return
+		}
+		var item favorites.FavoriteItem
+		if item, err = favorites.RemoveFavorite(userID, n); err == nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Removed favorite %d (%s #%s)", n, item.Provider, item.ContentID))
+		}
+	default:
+		s.ChannelMessageSend(m.ChannelID, favsHelp)
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error handling favorites: %v", err))
+	}
+}
+
+func listFavorites(s *discordgo.Session, m *discordgo.MessageCreate, userID int64, page int) error {
+	offset := (page - 1) * favoritesPageSize
+	items, total, err := favorites.ListFavorites(userID, offset, favoritesPageSize)
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		s.ChannelMessageSend(m.ChannelID, "No favorites yet, react to a post with ⭐ to save it")
+		return nil
+	}
+	pages := (total + favoritesPageSize - 1) / favoritesPageSize
+	lines := []string{fmt.Sprintf("Your favorites (page %d of %d):", page, pages)}
+	for idx, item := range items {
+		lines = append(lines, fmt.Sprintf("%d. %s #%s %s", offset+idx+1, item.Provider, item.ContentID, shortTagList(item.Tags)))
+	}
+	s.ChannelMessageSend(m.ChannelID, strings.Join(lines, "\n"))
+	return nil
+}
+
+// showFavorite re-posts a favorite regardless of whether it has been sent
+// before. The post is looked up again by its content ID so a changed file URL
+// doesn't break it. Favorites don't keep the query that found them, so the
+// repost has no "Another" button.
+func showFavorite(s *discordgo.Session, m *discordgo.MessageCreate, userID int64, n int) error {
+	item, err := favorites.GetFavorite(userID, n)
+	if err != nil {
+		return err
+	}
+
+	media := api.Media{
+		FileToSend: api.FileToSend{URL: item.URL},
+		Provider:   item.Provider,
+		ID:         item.ContentID,
+		Tags:       item.Tags,
+	}
+	if lookup, ok := newSearcher(item.Provider).(api.MediaLookup); ok {
+		fresh, err := lookup.Lookup(item.ContentID)
+		if err == nil {
+			media = fresh
+			if fresh.URL != item.URL {
+				if err := favorites.UpdateURL(item.ID, fresh.URL); err != nil {
+					log.Printf("failed to update favorite %d: %v", item.ID, err)
+				}
+			}
+		} else if !errors.Is(err, api.ErrNoResults) {
+			log.Printf("failed to look up %s #%s: %v", item.Provider, item.ContentID, err)
+		}
+	}
+
+	if err := checkMediaPolicy(s, m.ChannelID, nil); err != nil {
+		return err
+	}
+	if isForbiddenMedia(media) {
+		return fmt.Errorf("that post has a forbidden tag")
+	}
+
+	sizeLimit := uploadSizeLimit(s, m.GuildID)
+	req := mediaRequest{
+		ChannelID: m.ChannelID,
+		GuildID:   m.GuildID,
+		Author:    m.Author,
+		Provider:  item.Provider,
+		Count:     1,
+		NoRepeat:  true,
+	}
+	return sendFiles(s, m.ChannelID, []downloadedFile{downloadMedia(media, sizeLimit)}, sizeLimit, resultContext{Request: req})
+}
+
+// handleFavoriteInteraction saves a single-file result to the user's
+// favorites, or offers the files of a multi-file result to pick from.
+func handleFavoriteInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, messageID string, user *discordgo.User, items posts.PostItems) {
+	if len(items) == 1 {
+		saveFavoritesAndRespond(s, i, user, items)
+		return
+	}
+	if len(items) > maxSelectOptions {
+		items = items[:maxSelectOptions]
+	}
+	var options []discordgo.SelectMenuOption
+	for idx, item := range items {
+		// Discord caps option descriptions at 100 characters
+		description := []rune(strings.Join(item.Tags, " "))
+		if len(description) > 100 {
+			description = append(description[:99], '…')
+		}
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       fmt.Sprintf("%d. %s #%s", idx+1, item.Provider, item.ContentID),
+			Description: string(description),
+			Value:       strconv.Itoa(idx),
+		})
+	}
+	minValues := 1
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "Pick the files to save to your favorites:",
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.SelectMenu{
+						// the menu lives on its own message, so carry the result's ID along
+						CustomID:    mediaFavoriteSelectID + "|" + messageID,
+						Placeholder: "Files to favorite",
+						MinValues:   &minValues,
+						MaxValues:   len(options),
+						Options:     options,
+					},
+				}},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("failed to respond to interaction: %v", err)
+	}
+}
+
+// handleFavoriteSelectInteraction saves the files picked from a multi-file
+// result. values are the files' positions in the result.
+func handleFavoriteSelectInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, user *discordgo.User, items posts.PostItems, values []string) {
+	var picked posts.PostItems
+	for _, value := range values {
+		idx, err := strconv.Atoi(value)
+		if err != nil || idx < 0 || idx >= len(items) {
+			continue
+		}
+		picked = append(picked, items[idx])
+	}
+	if len(picked) == 0 {
+		respondEphemeral(s, i, "Pick at least one file to save.")
+		return
+	}
+	saveFavoritesAndRespond(s, i, user, picked)
+}
+
+func saveFavoritesAndRespond(s *discordgo.Session, i *discordgo.InteractionCreate, user *discordgo.User, items posts.PostItems) {
+	if err := saveFavorites(parseSnowflake(user.ID), items); err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("Error handling favorites: %v", err))
+		return
+	}
+	respondEphemeral(s, i, "Saved to your favorites ⭐")
+}
+
+func saveFavorites(userID int64, items posts.PostItems) error {
+	var favs favorites.FavoriteItems
+	for _, item := range items {
+		favs = append(favs, favorites.FavoriteItem{
+			Provider:  item.Provider,
+			ContentID: item.ContentID,
+			URL:       item.URL,
+			Tags:      item.Tags,
+		})
+	}
+	return favorites.AddFavorites(userID, favs)
+}
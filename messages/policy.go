@@ -0,0 +1,90 @@
+package messages
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"strings"
+
+	"kannonfoundry/whutbot3/api"
+	"kannonfoundry/whutbot3/config"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// checkMediaPolicy returns an error explaining why media for the tags can't be
+// posted to the channel: it isn't marked NSFW or the tags include a forbidden
+// one. Every refusal is logged.
+func checkMediaPolicy(s *discordgo.Session, channelID string, tags []string) error {
+	if !channelIsNSFW(s, channelID) {
+		log.Printf("refused media in channel %s: not marked NSFW", channelID)
+		return fmt.Errorf("media commands only work in channels marked NSFW")
+	}
+	if tag := forbiddenTag(tags); tag != "" {
+		log.Printf("refused media in channel %s: query %q includes forbidden tag %s", channelID, strings.Join(tags, " "), tag)
+		return fmt.Errorf("`%s` isn't allowed", tag)
+	}
+	return nil
+}
+
+// channelIsNSFW reports whether the channel, or the channel a thread is in, is
+// marked NSFW.
+func channelIsNSFW(s *discordgo.Session, channelID string) bool {
+	channel, err := lookupChannel(s, channelID)
+	if err != nil {
+		log.Printf("failed to get channel %s: %v", channelID, err)
+		return false
+	}
+	if channel.IsThread() {
+		if channel, err = lookupChannel(s, channel.ParentID); err != nil {
+			log.Printf("failed to get parent of thread %s: %v", channelID, err)
+			return false
+		}
+	}
+	return channel.NSFW
+}
+
+func lookupChannel(s *discordgo.Session, channelID string) (*discordgo.Channel, error) {
+	if channel, err := s.State.Channel(channelID); err == nil {
+		return channel, nil
+	}
+	return s.Channel(channelID)
+}
+
+// forbiddenTag returns the first of the tags that is forbidden, or would match
+// a forbidden tag as a wildcard, or "" if none are. Exclusions ("-tag") are fine.
+func forbiddenTag(tags []string) string {
+	forbidden := config.Default().ForbiddenTags
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		if strings.HasPrefix(tag, "-") {
+			continue
+		}
+		tag = strings.TrimPrefix(tag, "~")
+		if slices.Contains(forbidden, tag) {
+			return tag
+		}
+		if strings.Contains(tag, "*") {
+			for _, f := range forbidden {
+				if ok, _ := path.Match(tag, f); ok {
+					return tag
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// isForbiddenMedia reports whether the post carries a forbidden tag, logging it
+// if so.
+func isForbiddenMedia(file api.Media) bool {
+	forbidden := config.Default().ForbiddenTags
+	for _, tag := range file.Tags {
+		if slices.Contains(forbidden, strings.ToLower(tag)) {
+			log.Printf("refused %s post %s: tagged %s", file.Provider, file.ID, tag)
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package messages
 
 import (
+	"strings"
+
 	"kannonfoundry/whutbot3/config"
 
 	"github.com/bwmarrin/discordgo"
@@ -9,11 +11,14 @@ import (
 // HandlerFunc defines the signature for message handler functions.
 type HandlerFunc func(s *discordgo.Session, m *discordgo.MessageCreate)
 
-func DefaultHandlers(cfg *config.Config) map[string]HandlerFunc {
+// DefaultHandlers returns the message handler for each configured channel.
+// stash is shared with the interaction handlers and retry worker so they use
+// the same Whisparr tag cache.
+func DefaultHandlers(cfg *config.Config, stash *StashHandler) map[string]HandlerFunc {
 	return map[string]HandlerFunc{
-		cfg.WhisparrChannelID: HandleStashMessage,
+		cfg.WhisparrChannelID: stash.HandleStashMessage,
 		cfg.K8SChannelID:      HandleK8sMessage,
-		cfg.R34ChannelID:      HandleR34Message,
+		cfg.R34ChannelID:      RateLimited(cfg, HandleR34Message),
 	}
 }
 
@@ -30,3 +35,28 @@ func DispatchMessageByChannel(handlers map[string]HandlerFunc) func(s *discordgo
 		}
 	}
 }
+
+// InteractionHandlerFunc defines the signature for message component handler functions.
+type InteractionHandlerFunc func(s *discordgo.Session, i *discordgo.InteractionCreate)
+
+func DefaultInteractionHandlers(cfg *config.Config, stash *StashHandler) map[string]InteractionHandlerFunc {
+	return map[string]InteractionHandlerFunc{
+		MediaComponentPrefix: RateLimitedInteraction(cfg, HandleMediaInteraction),
+		StashComponentPrefix: stash.HandleStashInteraction,
+	}
+}
+
+// DispatchInteraction dispatches message component interactions based on the
+// prefix of their custom ID (everything before the first colon).
+func DispatchInteraction(handlers map[string]InteractionHandlerFunc) func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if i.Type != discordgo.InteractionMessageComponent {
+			return
+		}
+		prefix, _, _ := strings.Cut(i.MessageComponentData().CustomID, ":")
+		handler, ok := handlers[prefix]
+		if ok {
+			handler(s, i)
+		}
+	}
+}
@@ -1,20 +1,53 @@
 package messages
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"kannonfoundry/whutbot3/api"
 	redgifsapi "kannonfoundry/whutbot3/api/redgifs"
 	"kannonfoundry/whutbot3/api/rule34"
+	"kannonfoundry/whutbot3/config"
+	"kannonfoundry/whutbot3/db/aliases"
+	"kannonfoundry/whutbot3/db/feedback"
+	"kannonfoundry/whutbot3/db/lastquery"
 	prefs "kannonfoundry/whutbot3/db/preferences"
 	"kannonfoundry/whutbot3/db/sent"
-	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+const (
+	rule34Provider  = "rule34"
+	redgifsProvider = "redgifs"
+)
+
+// mediaRequest describes a search to run and where to post its results.
+type mediaRequest struct {
+	ChannelID string
+	GuildID   string
+	Author    *discordgo.User
+	Provider  string
+	Count     int
+	// Query is the tags as the user typed them, before aliases and preferences.
+	Query string
+	// RememberQuery saves the search as the author's last query, for "more".
+	RememberQuery bool
+	// NoRepeat leaves the "Another" button off the results, for posts that
+	// weren't found by searching Query.
+	NoRepeat bool
+}
+
+func newSearcher(provider string) api.MediaSearcher {
+	if provider == redgifsProvider {
+		return redgifsapi.NewClient()
+	}
+	return rule34.NewClient()
+}
+
 func HandleR34Message(s *discordgo.Session, m *discordgo.MessageCreate) {
 	if m.Author == nil || m.Author.Bot {
 		return
@@ -24,10 +57,20 @@ func HandleR34Message(s *discordgo.Session, m *discordgo.MessageCreate) {
 	switch command {
 	case "prefs":
 		handlePrefsCommand(s, m, arguments)
+	case "subscribe":
+		handleSubscribeCommand(s, m, arguments)
+	case "subscriptions":
+		handleSubscriptionsCommand(s, m, arguments)
+	case "schedule":
+		handleScheduleCommand(s, m, arguments)
+	case "favs":
+		handleFavsCommand(s, m, arguments)
+	case "alias":
+		handleAliasCommand(s, m, arguments)
 	case "gimme":
 		handleGimmeCommand(s, m, arguments)
 	case "more":
-		handleMoreCommand(s, m, 0, "")
+		handleMoreCommand(s, m, arguments)
 	default:
 		s.ChannelMessageSend(m.ChannelID, "Unknown r34 command")
 	}
@@ -53,158 +96,314 @@ func handlePrefsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args s
 		if err == nil {
 			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Your preferences: %s", prefs.String()))
 		}
+	case "insights":
+		var likes, dislikes feedback.AffinityItems
+		likes, dislikes, err = feedback.TopAffinities(authorID, 10)
+		if err == nil {
+			if len(likes) == 0 && len(dislikes) == 0 {
+				s.ChannelMessageSend(m.ChannelID, "No insights yet, react to single posts with 👍 or 👎 to teach me what you like")
+			} else {
+				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("You seem to like: %s\nYou seem to dislike: %s", likes.String(), dislikes.String()))
+			}
+		}
 	}
 	if err != nil {
 		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error handling preferences: %v", err))
 	}
 }
 
-func handleMoreCommand(s *discordgo.Session, m *discordgo.MessageCreate, depth int, lastMessageID string) {
-	if depth == 0 {
-		s.MessageReactionAdd(m.ChannelID, m.ID, "🔍")
-		s.ChannelMessageSend(m.ChannelID, "More command received")
+// maxMorePages bounds how many pages "more" will read looking for unsent results.
+const maxMorePages = 3
+
+// handleMoreCommand continues the user's last query: "more [N]" posts up to N
+// results that haven't been sent yet, moving on to later pages as earlier
+// ones run out.
+func handleMoreCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) {
+	count := 1
+	if n, err := strconv.Atoi(strings.TrimSpace(args)); err == nil && n > 0 {
+		count = min(n, config.Default().GimmeMaxCount)
+	}
+	authorID := parseSnowflake(m.Author.ID)
+	q, err := lastquery.GetLastQuery(authorID)
+	if errors.Is(err, lastquery.ErrNotFound) {
+		s.ChannelMessageSend(m.ChannelID, "No recent gimme command found.")
+		return
 	}
-	found := false
-	msgs, err := s.ChannelMessages(m.ChannelID, 10, lastMessageID, "", "")
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error fetching messages: %v", err))
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error loading your last query: %v", err))
+		return
+	}
+	if err := checkMediaPolicy(s, m.ChannelID, q.Tags); err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Can't search: %v", err))
+		return
+	}
+	searcher, ok := newSearcher(q.Provider).(api.PagedSearcher)
+	if !ok {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("%s can't fetch more results", q.Provider))
 		return
 	}
 
-	for _, msg := range msgs {
-		if msg.Author.Bot {
-			continue
+	s.MessageReactionAdd(m.ChannelID, m.ID, "🔍")
+	defer s.MessageReactionRemove(m.ChannelID, m.ID, "🔍", s.State.User.ID)
+
+	sentDB, err := sent.NewSentDB()
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error initializing sent database: %v", err))
+		return
+	}
+	defer sentDB.Close()
+
+	affinities, err := feedback.GetAffinities(authorID)
+	if err != nil {
+		fmt.Printf("error getting tag affinity: %v", err)
+	}
+	sizeLimit := uploadSizeLimit(s, m.GuildID)
+	var downloads []downloadedFile
+	page := q.Page
+	for read := 0; len(downloads) < count && read < maxMorePages; read++ {
+		files, err := cachedPage(searcher, q.Provider, q.Tags, page)
+		if isEmptySearch(files, err) {
+			break
+		}
+		if err != nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error fetching posts: %v", err))
+			return
+		}
+		found, err := collectUnsentFiles(rankByAffinity(files, affinities), count-len(downloads), sizeLimit, sentDB)
+		downloads = append(downloads, found...)
+		if err != nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("%v", err))
+			break
 		}
-		if strings.HasPrefix(strings.ToLower(msg.Content), "gimme") {
-			found = true
-			_, arguments := parseCommand(msg.Content)
-			handleGimmeCommand(s, m, arguments)
-			s.MessageReactionRemove(m.ChannelID, m.ID, "🔍", s.State.User.ID)
+		if len(found) == 0 {
+			invalidatePage(q.Provider, q.Tags, page)
 		}
+		if len(downloads) < count {
+			page++
+		}
+	}
+	if err := lastquery.SetPage(authorID, page); err != nil {
+		fmt.Printf("error saving page: %v", err)
+	}
+	if len(downloads) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "No more new files for that search")
+		return
+	}
 
+	req := mediaRequest{
+		ChannelID: m.ChannelID,
+		GuildID:   m.GuildID,
+		Author:    m.Author,
+		Provider:  q.Provider,
+		Count:     count,
+		// the original query, so "Another" doesn't add preferences a second time
+		Query: q.Query,
 	}
-	if !found && depth < 3 {
-		handleMoreCommand(s, m, depth+1, msgs[len(msgs)-1].ID)
-	} else if !found {
-		s.MessageReactionRemove(m.ChannelID, m.ID, "🔍", s.State.User.ID)
-		s.ChannelMessageSend(m.ChannelID, "No recent gimme command found.")
+	if err := sendFiles(s, m.ChannelID, downloads, sizeLimit, resultContext{Request: req, SearchTerm: strings.Join(q.Tags, " ")}); err != nil {
+		unmarkSent(sentDB, downloads)
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error sending file: %v", err))
+		fmt.Printf("error sending file: %v", err)
 	}
 }
 
 func handleGimmeCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) {
 	// Handle the "gimme" command
-	var searchClient api.MediaSearcher
-	var searchArgs string
-	//check if first argument is gif
-	command, gifArgs := parseCommand(args)
-	if command == "gif" {
-		searchClient = redgifsapi.NewClient()
-		searchArgs = gifArgs
-	} else {
-		searchClient = rule34.NewClient()
-		searchArgs = args
+	gif, count, searchArgs := parseGimmeArgs(args, config.Default().GimmeMaxCount)
+	provider := rule34Provider
+	if gif {
+		provider = redgifsProvider
 	}
+	postMedia(s, mediaRequest{
+		ChannelID: m.ChannelID,
+		GuildID:   m.GuildID,
+		Author:    m.Author,
+		Provider:  provider,
+		Count:     count,
+		Query:     searchArgs,
+
+		RememberQuery: true,
+	})
+}
+
+// postMedia runs the request's search and posts up to req.Count results that
+// haven't been sent before to the request's channel.
+func postMedia(s *discordgo.Session, req mediaRequest) {
+	searchClient := newSearcher(req.Provider)
 	//s.ChannelMessageSend(m.ChannelID, "Gimme command received with args: "+args)
-	fmt.Printf("Searching for: %v", searchArgs)
-	authorID, err := strconv.ParseInt(m.Author.ID, 10, 64)
+	fmt.Printf("Searching for: %v", req.Query)
+	authorID, err := strconv.ParseInt(req.Author.ID, 10, 64)
 	if err != nil {
 		fmt.Printf("error parsing user ID: %v", err)
 	}
-	searchTerm, err := searchClient.FormatAndModifySearch(strings.Fields(searchArgs), authorID)
+	// the user's own tags, with aliases expanded, are never relaxed
+	userTags, err := aliases.Expand(strings.Fields(req.Query), authorID, parseSnowflake(req.GuildID))
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error modifying search: %v", err))
+		s.ChannelMessageSend(req.ChannelID, fmt.Sprintf("Error modifying search: %v", err))
+		return
+	}
+	searchTerm, err := searchClient.FormatAndModifySearch(userTags, authorID)
+	if err != nil {
+		s.ChannelMessageSend(req.ChannelID, fmt.Sprintf("Error modifying search: %v", err))
+		return
+	}
+	// checked after aliases and preferences are applied, so neither can get around it
+	if err := checkMediaPolicy(s, req.ChannelID, strings.Fields(searchTerm)); err != nil {
+		s.ChannelMessageSend(req.ChannelID, fmt.Sprintf("Can't search: %v", err))
 		return
 	}
 
-	searchMsg, _ := s.ChannelMessageSend(m.ChannelID, "Gonna search for: "+searchTerm)
-	// Fetch posts from the API
-	files, err := searchClient.Search(strings.Fields(searchTerm))
+	// Fetch posts from the API, dropping preferences if they over-constrain the query
+	files, relaxed, cached, err := cachedSearch(searchClient, req.Provider, userTags, strings.Fields(searchTerm), false)
 	if err != nil {
-		if err == io.EOF {
-			s.ChannelMessageSend(m.ChannelID, "No posts found.")
+		if err == io.EOF || errors.Is(err, api.ErrNoResults) {
+			s.ChannelMessageSend(req.ChannelID, noResultsMessage(searchClient, userTags))
 		} else {
 			fmt.Printf("error fetching posts: %v", err)
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error fetching posts: %v", err))
+			s.ChannelMessageSend(req.ChannelID, fmt.Sprintf("Error fetching posts: %v", err))
 		}
 		return
 	}
 
 	fmt.Printf("Found files: %d", len(files))
-	//check if the posts slice is empty
-
-	if len(files) == 0 {
-		s.ChannelMessageSend(m.ChannelID, "No posts found.")
-		return
+	if len(relaxed) > 0 {
+		s.ChannelMessageSend(req.ChannelID, fmt.Sprintf("Nothing matched all your preferences, so I relaxed: %s", strings.Join(relaxed, " ")))
+	}
+	if req.RememberQuery {
+		finalTags := slices.DeleteFunc(strings.Fields(searchTerm), func(t string) bool { return slices.Contains(relaxed, t) })
+		err := lastquery.SaveLastQuery(lastquery.LastQuery{UserID: authorID, Provider: req.Provider, Tags: finalTags, Query: req.Query})
+		if err != nil {
+			fmt.Printf("error saving last query: %v", err)
+		}
 	}
 
 	sentDB, err := sent.NewSentDB()
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error initializing sent database: %v", err))
+		s.ChannelMessageSend(req.ChannelID, fmt.Sprintf("Error initializing sent database: %v", err))
 		return
 	}
 	defer sentDB.Close()
 
-	var fileUrl = ""
-	var resp *http.Response
+	// prefer results carrying tags the user has liked before
+	affinities, err := feedback.GetAffinities(authorID)
+	if err != nil {
+		fmt.Printf("error getting tag affinity: %v", err)
+	}
+	files = rankByAffinity(files, affinities)
 
-	for _, file := range files {
-		beenSent, err := sentDB.HasBeenSent(file.URL)
-		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error checking sent database: %v", err))
-			return
-		}
-		if !beenSent {
-			fileUrl = file.URL
-			resp, err := fetchAndMarkAsSent(fileUrl, sentDB) // We either send it or skip it for being too large, so don't send again
-			if err != nil {
-				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("%v", err))
-				return
-			}
-			defer resp.Body.Close()
-			if resp.Header.Get("Content-Length") != "" && resp.ContentLength > 8*1024*1024 {
-				resp.Body.Close()
-				fileUrl = ""
-				continue
-			} else {
-				break
-			}
+	sizeLimit := uploadSizeLimit(s, req.GuildID)
+	downloads, err := collectUnsentFiles(files, req.Count, sizeLimit, sentDB)
+	if err == nil && cached && len(downloads) < req.Count {
+		// the cached results have run out, so ask the provider for fresh ones;
+		// the refresh replaces the cache entry, or invalidates it if it fails
+		files, _, _, err = cachedSearch(searchClient, req.Provider, userTags, strings.Fields(searchTerm), true)
+		if err == nil {
+			var fresh []downloadedFile
+			fresh, err = collectUnsentFiles(rankByAffinity(files, affinities), req.Count-len(downloads), sizeLimit, sentDB)
+			downloads = append(downloads, fresh...)
 		}
 	}
-	if fileUrl == "" || resp == nil {
-		s.ChannelMessageSend(m.ChannelID, "No new files found")
+	if len(downloads) == 0 {
+		if err != nil {
+			s.ChannelMessageSend(req.ChannelID, fmt.Sprintf("%v", err))
+		} else {
+			s.ChannelMessageSend(req.ChannelID, "No new files found")
+		}
 		return
 	}
-
 	if err != nil {
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error marking post as sent: %v", err))
-		return
+		fmt.Printf("error collecting files: %v", err)
 	}
-	_, err = s.ChannelFileSend(m.ChannelID, fileUrl, resp.Body)
+
+	err = sendFiles(s, req.ChannelID, downloads, sizeLimit, resultContext{Request: req, SearchTerm: searchTerm})
 	if err != nil {
-		if strings.Contains(err.Error(), "entity too large") {
-			s.ChannelMessageSend(m.ChannelID, "The booty too big 🥵")
+		unmarkSent(sentDB, downloads)
+		s.ChannelMessageSend(req.ChannelID, fmt.Sprintf("Error sending file: %v", err))
+		fmt.Printf("error sending file: %v", err)
+	}
+	if len(downloads) < req.Count {
+		s.ChannelMessageSend(req.ChannelID, fmt.Sprintf("Only found %d new files", len(downloads)))
+	}
+}
+
+// parseGimmeArgs splits "gimme [gif] [N] tags..." into its parts. N defaults to
+// one and is capped at maxCount.
+func parseGimmeArgs(args string, maxCount int) (gif bool, count int, searchArgs string) {
+	count = 1
+	searchArgs = args
+	for {
+		command, rest := parseCommand(searchArgs)
+		if command == "gif" && !gif {
+			gif = true
+		} else if n, err := strconv.Atoi(command); err == nil && n > 0 {
+			count = n
 		} else {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error sending file: %v", err))
-			fmt.Printf("error sending file: %v", err)
+			break
 		}
-	} else {
-		s.ChannelMessageDelete(searchMsg.ChannelID, searchMsg.ID)
+		searchArgs = rest
+	}
+	if maxCount > 0 && count > maxCount {
+		count = maxCount
+	}
+	return gif, count, searchArgs
+}
+
+// searchWithRelaxation runs the search and, when it comes back empty, retries it
+// with the tags that aren't part of the user's own query (i.e. appended preferences)
+// dropped one at a time, most recently appended first. It returns the tags that
+// had to be dropped to get results.
+func searchWithRelaxation(searchClient api.MediaSearcher, userTags []string, searchTags []string) (files []api.Media, relaxed []string, err error) {
+	files, err = searchClient.Search(searchTags)
+	if !isEmptySearch(files, err) {
+		return files, nil, err
 	}
 
+	typed := map[string]bool{}
+	for _, tag := range userTags {
+		typed[tag] = true
+	}
+	remaining := searchTags
+	for i := len(searchTags) - 1; i >= 0; i-- {
+		tag := searchTags[i]
+		if typed[tag] {
+			continue
+		}
+		remaining = slices.DeleteFunc(slices.Clone(remaining), func(t string) bool { return t == tag })
+		relaxed = append(relaxed, tag)
+		files, err = searchClient.Search(remaining)
+		if !isEmptySearch(files, err) {
+			return files, relaxed, err
+		}
+	}
+	return nil, nil, api.ErrNoResults
 }
 
-func fetchAndMarkAsSent(fileUrl string, sentDB *sent.SentDB) (resp *http.Response, err error) {
-	req, err := http.NewRequest("GET", fileUrl, nil)
+func isEmptySearch(files []api.Media, err error) bool {
 	if err != nil {
-		return nil, fmt.Errorf("Error creating HTTP request: %v", err)
+		return err == io.EOF || errors.Is(err, api.ErrNoResults)
 	}
+	return len(files) == 0
+}
 
-	client := &http.Client{}
-	resp, err = client.Do(req)
+// noResultsMessage builds the reply for a search that found nothing, including
+// "did you mean" suggestions when the searcher can provide them.
+func noResultsMessage(searchClient api.MediaSearcher, userTags []string) string {
+	msg := "No posts found."
+	suggester, ok := searchClient.(api.TagSuggester)
+	if !ok {
+		return msg
+	}
+	suggestions, err := suggester.SuggestTags(userTags)
 	if err != nil {
-		return
+		fmt.Printf("error suggesting tags: %v", err)
 	}
-
-	err = sentDB.MarkAsSent(fileUrl)
-	return resp, err
+	var hints []string
+	for _, tag := range userTags {
+		if suggestion, ok := suggestions[tag]; ok {
+			hints = append(hints, fmt.Sprintf("`%s` → `%s`", tag, suggestion))
+		}
+	}
+	if len(hints) > 0 {
+		msg += " Did you mean: " + strings.Join(hints, ", ") + "?"
+	}
+	return msg
 }
@@ -0,0 +1,99 @@
+package messages
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"kannonfoundry/whutbot3/config"
+	"kannonfoundry/whutbot3/ratelimit"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// mediaCommands are the commands that search providers and upload files, and
+// so count against rate limits and quotas.
+var mediaCommands = map[string]bool{
+	"gimme": true,
+	"more":  true,
+}
+
+var (
+	mediaLimitsOnce sync.Once
+	mediaLimits     *ratelimit.Limits
+)
+
+// sharedMediaLimits returns the limits shared by media commands and the
+// "Another" button.
+func sharedMediaLimits(cfg *config.Config) *ratelimit.Limits {
+	mediaLimitsOnce.Do(func() {
+		mediaLimits = ratelimit.NewLimits(
+			ratelimit.NewQuota(cfg.DailyMediaQuota),
+			ratelimit.New(cfg.UserRateBurst, time.Duration(cfg.UserRateSeconds)*time.Second),
+			ratelimit.New(cfg.ChannelRateBurst, time.Duration(cfg.ChannelRateSeconds)*time.Second),
+		)
+	})
+	return mediaLimits
+}
+
+// RateLimited wraps a handler so media commands are limited per user and per
+// channel, and optionally to a daily quota per user. Moderators are exempt.
+func RateLimited(cfg *config.Config, next HandlerFunc) HandlerFunc {
+	limits := sharedMediaLimits(cfg)
+	return func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		command, _ := parseCommand(m.Content)
+		if !mediaCommands[command] || isModerator(s, m.Author.ID, m.ChannelID) {
+			next(s, m)
+			return
+		}
+		if msg := checkMediaLimits(limits, m.Author.ID, m.ChannelID); msg != "" {
+			s.ChannelMessageSendReply(m.ChannelID, msg, m.Reference())
+			return
+		}
+		next(s, m)
+	}
+}
+
+// RateLimitedInteraction wraps a component handler so the "Another" button
+// counts against the same limits as media commands. Moderators are exempt.
+func RateLimitedInteraction(cfg *config.Config, next InteractionHandlerFunc) InteractionHandlerFunc {
+	limits := sharedMediaLimits(cfg)
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		action, _, _ := strings.Cut(i.MessageComponentData().CustomID, "|")
+		if action != mediaAnotherID || interactionIsModerator(i) {
+			next(s, i)
+			return
+		}
+		if msg := checkMediaLimits(limits, interactionUser(i).ID, i.ChannelID); msg != "" {
+			respondEphemeral(s, i, msg)
+			return
+		}
+		next(s, i)
+	}
+}
+
+// checkMediaLimits uses up the user's and channel's allowance for one media
+// post, returning what to tell the user if they are out of it.
+func checkMediaLimits(limits *ratelimit.Limits, userID string, channelID string) string {
+	denial, wait := limits.Allow(userID, channelID, time.Now())
+	switch denial {
+	case ratelimit.QuotaReached:
+		log.Printf("daily quota reached for %s", userID)
+		return fmt.Sprintf("You've used today's quota, it resets in %s.", formatWait(wait))
+	case ratelimit.UserLimited:
+		return fmt.Sprintf("Slow down, try again in %s.", formatWait(wait))
+	case ratelimit.ChannelLimited:
+		return fmt.Sprintf("This channel is busy, try again in %s.", formatWait(wait))
+	}
+	return ""
+}
+
+// formatWait rounds a cooldown up to whole seconds, or minutes once it's long.
+func formatWait(d time.Duration) string {
+	if d > time.Hour {
+		return d.Round(time.Minute).String()
+	}
+	return (d.Truncate(time.Second) + time.Second).String()
+}
@@ -0,0 +1,144 @@
+package messages
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+
+	"kannonfoundry/whutbot3/api"
+	"kannonfoundry/whutbot3/db/feedback"
+	"kannonfoundry/whutbot3/db/posts"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// feedbackReactions maps the reactions the bot learns from to how they
+// change the reacting user's affinity for the post's tags. Only single-file
+// results are learned from, since a reaction can't say which file it meant.
+var feedbackReactions = map[string]int{
+	"👍": 1,
+	"👎": -1,
+}
+
+// favoriteReaction saves a single-file media result to the reacting user's
+// favorites. Multi-file results are saved file by file with the Favorite button.
+const favoriteReaction = "⭐"
+
+// maxKnownMessages caps how many messages botMessages remembers.
+const maxKnownMessages = 10000
+
+// botMessages remembers whether messages that got feedback reactions were
+// posted by the bot, so reactions elsewhere don't touch the database.
+var botMessages = struct {
+	sync.Mutex
+	byID map[string]bool
+}{byID: map[string]bool{}}
+
+func rememberMessage(messageID string, fromBot bool) {
+	botMessages.Lock()
+	defer botMessages.Unlock()
+	if len(botMessages.byID) >= maxKnownMessages {
+		botMessages.byID = map[string]bool{}
+	}
+	botMessages.byID[messageID] = fromBot
+}
+
+// isBotMessage reports whether the bot posted the message, asking Discord the
+// first time a message is seen.
+func isBotMessage(s *discordgo.Session, channelID string, messageID string) bool {
+	botMessages.Lock()
+	fromBot, ok := botMessages.byID[messageID]
+	botMessages.Unlock()
+	if ok {
+		return fromBot
+	}
+	if s.State.User == nil {
+		return true
+	}
+	msg, err := s.State.Message(channelID, messageID)
+	if err != nil {
+		if msg, err = s.ChannelMessage(channelID, messageID); err != nil {
+			log.Printf("failed to get message %s: %v", messageID, err)
+			return false
+		}
+	}
+	fromBot = msg.Author != nil && msg.Author.ID == s.State.User.ID
+	rememberMessage(messageID, fromBot)
+	return fromBot
+}
+
+// HandleMediaReactionAdd learns from a user's 👍/👎 on a single-file media
+// result and saves it to their favorites on ⭐.
+func HandleMediaReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	handleMediaReaction(s, r.MessageReaction, true)
+}
+
+// HandleMediaReactionRemove forgets a 👍/👎 the user took back.
+func HandleMediaReactionRemove(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	handleMediaReaction(s, r.MessageReaction, false)
+}
+
+func handleMediaReaction(s *discordgo.Session, r *discordgo.MessageReaction, added bool) {
+	if s.State.User != nil && r.UserID == s.State.User.ID {
+		return
+	}
+	value, ok := feedbackReactions[r.Emoji.Name]
+	if !ok && r.Emoji.Name != favoriteReaction {
+		return
+	}
+	if !isBotMessage(s, r.ChannelID, r.MessageID) {
+		return
+	}
+	messageID := parseSnowflake(r.MessageID)
+	items, err := posts.GetPosts(messageID)
+	if err != nil {
+		log.Printf("failed to get posts for %s: %v", r.MessageID, err)
+		return
+	}
+	if len(items) == 0 {
+		// not one of our media posts
+		return
+	}
+
+	userID := parseSnowflake(r.UserID)
+	if r.Emoji.Name == favoriteReaction {
+		if !added {
+			return
+		}
+		if len(items) > 1 {
+			s.ChannelMessageSend(r.ChannelID, fmt.Sprintf("<@%s> that post has %d files, use its Favorite button to pick which to save", r.UserID, len(items)))
+			return
+		}
+		err = saveFavorites(userID, items)
+	} else if len(items) > 1 {
+		return
+	} else if added {
+		err = feedback.RecordFeedback(userID, messageID, value, items.Tags())
+	} else {
+		err = feedback.RemoveFeedback(userID, messageID, value, items.Tags())
+	}
+	if err != nil {
+		log.Printf("failed to store feedback on %s from %s: %v", r.MessageID, r.UserID, err)
+	}
+}
+
+// rankByAffinity orders files so those whose tags the user likes most come
+// first. Files the user has no opinion on keep their original order.
+func rankByAffinity(files []api.Media, affinities map[string]int) []api.Media {
+	if len(affinities) == 0 {
+		return files
+	}
+	score := func(m api.Media) int {
+		total := 0
+		for _, tag := range m.Tags {
+			total += affinities[tag]
+		}
+		return total
+	}
+	ranked := slices.Clone(files)
+	slices.SortStableFunc(ranked, func(a, b api.Media) int {
+		return score(b) - score(a)
+	})
+	return ranked
+}
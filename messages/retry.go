@@ -0,0 +1,170 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"kannonfoundry/whutbot3/api/whisparr"
+	"kannonfoundry/whutbot3/db/jobs"
+	"kannonfoundry/whutbot3/db/requests"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxRetryDelay caps the exponential backoff between retries.
+const maxRetryDelay = 6 * time.Hour
+
+// queueRetry saves a Whisparr operation for a request that failed because
+// Whisparr was unavailable, so it is tried again after delay.
+func queueRetry(requestID int64, kind string, cause error, delay time.Duration) error {
+	_, err := jobs.AddJob(jobs.JobItem{
+		RequestID: requestID,
+		Kind:      kind,
+		Attempts:  1,
+		LastError: cause.Error(),
+		NextRun:   time.Now().Add(delay),
+	})
+	return err
+}
+
+// retryDelay is how long to wait before the next attempt after the given
+// number of failed ones, doubling each time up to maxRetryDelay.
+func retryDelay(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// StartRetryWorker retries queued Whisparr operations with h every minute
+// until stop is closed.
+func StartRetryWorker(s *discordgo.Session, h *StashHandler, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				h.runDueJobs(s, now)
+			}
+		}
+	}()
+}
+
+func (h *StashHandler) runDueJobs(s *discordgo.Session, now time.Time) {
+	items, err := jobs.GetDueJobs(now)
+	if err != nil {
+		log.Printf("failed to load Whisparr jobs: %v", err)
+		return
+	}
+	for _, item := range items {
+		h.runJob(s, item)
+	}
+}
+
+// runJob makes another attempt at a job. On success the requester gets a
+// reply to the message they made the request in; a job that keeps failing is
+// given up on after RetryAttempts attempts and the requester is told.
+func (h *StashHandler) runJob(s *discordgo.Session, job jobs.JobItem) {
+	item, err := requests.GetRequest(job.RequestID)
+	if err != nil && !errors.Is(err, requests.ErrNotFound) {
+		log.Printf("failed to get request %d for job %d: %v", job.RequestID, job.ID, err)
+		return
+	}
+	if err != nil || item.Outcome != requests.OutcomeRetrying {
+		// the request is gone or was handled some other way
+		if err := jobs.MarkDone(job.ID, job.Attempts); err != nil {
+			log.Printf("failed to update job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	ctx := context.Background()
+	attempts := job.Attempts + 1
+	var result linkResult
+	switch job.Kind {
+	case jobs.KindLookup:
+		result = h.retryLookup(ctx, s, item)
+	case jobs.KindAdd:
+		var imported bool
+		result, imported = h.tryAddScene(ctx, s, item)
+		if result.Outcome != outcomeRetrying {
+			if err := requests.SetOutcome(item.ID, string(result.Outcome), result.Title, imported); err != nil {
+				log.Printf("failed to update request %d: %v", item.ID, err)
+			}
+		}
+	default:
+		log.Printf("job %d has an unknown kind %q", job.ID, job.Kind)
+		if err := jobs.RecordFailure(job.ID, job.Attempts, "unknown job kind", time.Now(), true); err != nil {
+			log.Printf("failed to update job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	if result.Outcome == outcomeRetrying {
+		dead := attempts >= h.RetryAttempts
+		next := time.Now().Add(retryDelay(h.RetryDelay, attempts))
+		if err := jobs.RecordFailure(job.ID, attempts, result.Err.Error(), next, dead); err != nil {
+			log.Printf("failed to update job %d: %v", job.ID, err)
+		}
+		if !dead {
+			return
+		}
+		log.Printf("giving up on job %d after %d attempts: %v", job.ID, attempts, result.Err)
+		if err := requests.SetOutcome(item.ID, requests.OutcomeFailed, "", false); err != nil {
+			log.Printf("failed to update request %d: %v", item.ID, err)
+		}
+		notifyRequester(s, item, fmt.Sprintf("I gave up on `%s` after %d attempts, Whispar is still unavailable: %v", item.ForeignID, attempts, result.Err))
+		return
+	}
+
+	if result.Outcome == outcomeFailed {
+		if err := jobs.RecordFailure(job.ID, attempts, result.Err.Error(), time.Now(), true); err != nil {
+			log.Printf("failed to update job %d: %v", job.ID, err)
+		}
+	} else if err := jobs.MarkDone(job.ID, attempts); err != nil {
+		log.Printf("failed to update job %d: %v", job.ID, err)
+	}
+	// previews and approval requests reply to the request themselves
+	if result.Outcome != outcomePending && result.Outcome != outcomeAwaiting {
+		notifyRequester(s, item, "Whispar is back: "+result.String())
+	}
+}
+
+// retryLookup looks a requested scene up again and, if that works, carries on
+// with the request as processScene would have.
+func (h *StashHandler) retryLookup(ctx context.Context, s *discordgo.Session, item requests.RequestItem) linkResult {
+	link := StashLink{Kind: stashScene, ID: item.ForeignID}
+	movie, err := h.Whisparr.LookupScene(ctx, item.ForeignID)
+	if err != nil {
+		result := linkResult{Link: link, Title: item.Title, Outcome: outcomeFailed, Err: fmt.Errorf("error checking scene existence: %w", err)}
+		if whisparr.Unavailable(err) {
+			result.Outcome = outcomeRetrying
+		} else if err := requests.SetOutcome(item.ID, requests.OutcomeFailed, "", false); err != nil {
+			log.Printf("failed to update request %d: %v", item.ID, err)
+		}
+		return result
+	}
+	req := requestFromItem(s, item)
+	req.Member = lookupMember(s, req.GuildID, req.User.ID)
+	return h.continueScene(ctx, s, req, item.ID, link, movie)
+}
+
+// lookupMember fetches a guild member for role checks, or nil if that fails.
+func lookupMember(s *discordgo.Session, guildID string, userID string) *discordgo.Member {
+	if member, err := s.State.Member(guildID, userID); err == nil {
+		return member
+	}
+	member, err := s.GuildMember(guildID, userID)
+	if err != nil {
+		log.Printf("failed to get member %s: %v", userID, err)
+		return nil
+	}
+	return member
+}
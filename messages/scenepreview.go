@@ -0,0 +1,260 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"kannonfoundry/whutbot3/api/stashdb"
+	"kannonfoundry/whutbot3/api/whisparr"
+	"kannonfoundry/whutbot3/db/jobs"
+	"kannonfoundry/whutbot3/db/requests"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// StashComponentPrefix prefixes the custom ID of every component on a scene preview.
+const StashComponentPrefix = "stash"
+
+const (
+	stashAddID    = StashComponentPrefix + ":add"
+	stashCancelID = StashComponentPrefix + ":cancel"
+)
+
+// postScenePreview replies to the request with the scene's details and
+// buttons to add it to Whisparr or cancel.
+func (h *StashHandler) postScenePreview(ctx context.Context, s *discordgo.Session, req linkRequest, requestID int64, movie whisparr.Movie) error {
+	_, err := s.ChannelMessageSendComplex(req.ChannelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{h.sceneEmbed(ctx, movie)},
+		Components: scenePreviewComponents(requestID),
+		Reference: &discordgo.MessageReference{
+			MessageID: req.MessageID,
+			ChannelID: req.ChannelID,
+			GuildID:   req.GuildID,
+		},
+	})
+	return err
+}
+
+// sceneEmbed describes the scene using its details from StashDB, falling back
+// to what Whisparr's lookup returned when StashDB can't be reached.
+func (h *StashHandler) sceneEmbed(ctx context.Context, movie whisparr.Movie) *discordgo.MessageEmbed {
+	var scene *stashdb.Scene
+	if h.StashDB != nil {
+		found, err := h.StashDB.FindScene(ctx, movie.ForeignID)
+		if err != nil {
+			log.Printf("failed to fetch scene %s from StashDB: %v", movie.ForeignID, err)
+		} else {
+			scene = &found
+		}
+	}
+	return scenePreviewEmbed(movie, scene)
+}
+
+func scenePreviewComponents(requestID int64) []discordgo.MessageComponent {
+	id := strconv.FormatInt(requestID, 10)
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Add", Style: discordgo.SuccessButton, CustomID: stashAddID + "|" + id, Emoji: &discordgo.ComponentEmoji{Name: "🍑"}},
+			discordgo.Button{Label: "Cancel", Style: discordgo.SecondaryButton, CustomID: stashCancelID + "|" + id},
+		}},
+	}
+}
+
+func scenePreviewEmbed(movie whisparr.Movie, scene *stashdb.Scene) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: movie.Title,
+		URL:   StashPrefix + "/" + movie.ForeignID,
+		Color: 0xd35400,
+	}
+	studio, released, duration, cover := movie.StudioTitle, movie.ReleaseDate, time.Duration(movie.Runtime)*time.Minute, ""
+	for _, img := range movie.Images {
+		if cover == "" || img.CoverType == "screenshot" {
+			cover = img.RemoteURL
+		}
+	}
+	if scene != nil {
+		embed.Title = scene.Title
+		if scene.Studio != nil {
+			studio = scene.Studio.Name
+		}
+		released = scene.ReleaseDate
+		duration = time.Duration(scene.Duration) * time.Second
+		if url := scene.CoverURL(); url != "" {
+			cover = url
+		}
+		if names := scene.PerformerNames(); len(names) > 0 {
+			embed.Description = strings.Join(names, ", ")
+		}
+	}
+	if studio != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Studio", Value: studio, Inline: true})
+	}
+	if released != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Released", Value: strings.TrimSuffix(released, "T00:00:00Z"), Inline: true})
+	}
+	if duration > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Duration", Value: duration.String(), Inline: true})
+	}
+	if cover != "" {
+		embed.Image = &discordgo.MessageEmbedImage{URL: cover}
+	}
+	return embed
+}
+
+// HandleStashInteraction handles the buttons on scene previews, which only the
+// requester or a moderator may use, on requests awaiting approval, and on
+// unmonitor and remove prompts.
+func (h *StashHandler) HandleStashInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	parts := strings.Split(i.MessageComponentData().CustomID, "|")
+	switch parts[0] {
+	case stashAddID, stashCancelID:
+		h.handleRequestInteraction(s, i, parts[0], parts[1:])
+	case stashUnmonitorID, stashRemoveID, stashDismissID:
+		h.handleManageInteraction(s, i, parts[0], parts[1:])
+	case stashApproveID, stashRejectID:
+		h.handleApprovalInteraction(s, i, parts[0], parts[1:])
+	}
+}
+
+// handleRequestInteraction handles the Add and Cancel buttons on a scene preview.
+func (h *StashHandler) handleRequestInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, action string, args []string) {
+	if len(args) == 0 {
+		respondEphemeral(s, i, "That preview is broken.")
+		return
+	}
+	requestID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		respondEphemeral(s, i, "That preview is broken.")
+		return
+	}
+	item, err := requests.GetRequest(requestID)
+	if errors.Is(err, requests.ErrNotFound) {
+		respondEphemeral(s, i, "That request no longer exists.")
+		return
+	}
+	if err != nil {
+		log.Printf("failed to get request %d: %v", requestID, err)
+		respondEphemeral(s, i, "Couldn't find that request.")
+		return
+	}
+	if parseSnowflake(interactionUser(i).ID) != item.UserID && !interactionIsModerator(i) {
+		respondEphemeral(s, i, "Only the requester or a moderator can do that.")
+		return
+	}
+
+	switch action {
+	case stashAddID:
+		h.confirmScene(s, i, item)
+	case stashCancelID:
+		claimed, err := requests.ClaimRequest(item.ID, requests.OutcomePending, requests.OutcomeCancelled)
+		if err != nil || !claimed {
+			respondEphemeral(s, i, "That request has already been handled.")
+			return
+		}
+		updatePreview(s, i, "Cancelled.")
+	}
+}
+
+// confirmScene adds a previewed scene to Whisparr and updates the preview with
+// the outcome.
+func (h *StashHandler) confirmScene(s *discordgo.Session, i *discordgo.InteractionCreate, item requests.RequestItem) {
+	claimed, err := requests.ClaimRequest(item.ID, requests.OutcomePending, requests.OutcomeAdding)
+	if err != nil || !claimed {
+		respondEphemeral(s, i, "That request has already been handled.")
+		return
+	}
+	// adding can take longer than Discord waits for a response
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	if err != nil {
+		log.Printf("failed to acknowledge interaction: %v", err)
+	}
+
+	result := h.addRequestedScene(context.Background(), s, item)
+	content := result.String()
+	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:    &content,
+		Components: &[]discordgo.MessageComponent{},
+	}); err != nil {
+		log.Printf("failed to update preview: %v", err)
+	}
+}
+
+// addRequestedScene adds the scene a stored request asked for, with the
+// options it asked for, and records the outcome. If Whisparr can't be
+// reached the add is queued to be retried.
+func (h *StashHandler) addRequestedScene(ctx context.Context, s *discordgo.Session, item requests.RequestItem) linkResult {
+	result, imported := h.tryAddScene(ctx, s, item)
+	if result.Err != nil {
+		log.Printf("failed to add scene %s: %v", item.ForeignID, result.Err)
+	}
+	if result.Outcome == outcomeRetrying {
+		if err := queueRetry(item.ID, jobs.KindAdd, result.Err, h.RetryDelay); err != nil {
+			log.Printf("failed to queue retry for request %d: %v", item.ID, err)
+			result.Outcome = outcomeFailed
+		}
+	}
+	if err := requests.SetOutcome(item.ID, string(result.Outcome), result.Title, imported); err != nil {
+		log.Printf("failed to update request %d: %v", item.ID, err)
+	}
+	return result
+}
+
+// tryAddScene makes one attempt at adding a requested scene, reporting
+// whether it has already been imported. The outcome is retrying if Whisparr
+// couldn't be reached.
+func (h *StashHandler) tryAddScene(ctx context.Context, s *discordgo.Session, item requests.RequestItem) (linkResult, bool) {
+	req := requestFromItem(s, item)
+	link := StashLink{Kind: stashScene, ID: item.ForeignID}
+
+	result := linkResult{Link: link, Title: item.Title}
+	imported := false
+	movie, err := h.Whisparr.LookupScene(ctx, item.ForeignID)
+	switch {
+	case err != nil:
+		result.Outcome, result.Err = outcomeFailed, fmt.Errorf("error checking scene existence: %w", err)
+	case movie.InLibrary():
+		// added some other way while the preview was up
+		result.Title, result.Outcome = movie.Title, outcomePresent
+		imported = movie.HasFile
+	default:
+		result = h.addScene(ctx, req, link, movie)
+	}
+	if result.Outcome == outcomeFailed && whisparr.Unavailable(result.Err) {
+		result.Outcome = outcomeRetrying
+	}
+	return result, imported
+}
+
+// requestFromItem rebuilds the link request a stored request was made with.
+func requestFromItem(s *discordgo.Session, item requests.RequestItem) linkRequest {
+	return linkRequest{
+		GuildID:   strconv.FormatInt(item.GuildID, 10),
+		ChannelID: strconv.FormatInt(item.ChannelID, 10),
+		MessageID: strconv.FormatInt(item.MessageID, 10),
+		User:      lookupUser(s, item.UserID),
+		Options: addOptions{
+			QualityProfileID: item.QualityProfileID,
+			RootFolderPath:   item.RootFolder,
+			Tags:             item.Tags,
+		},
+	}
+}
+
+// updatePreview replaces a preview's buttons with a message.
+func updatePreview(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Printf("failed to respond to interaction: %v", err)
+	}
+}
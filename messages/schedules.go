@@ -0,0 +1,217 @@
+package messages
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"kannonfoundry/whutbot3/cron"
+	"kannonfoundry/whutbot3/db/schedules"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const scheduleHelp = "Available schedule commands: add <cron> <rule34|redgifs> <tags...>, list, pause <id>, resume <id>, remove <id>, timezone <zone>"
+
+func handleScheduleCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) {
+	if !isAdmin(s, m.Author.ID, m.ChannelID) {
+		s.ChannelMessageSend(m.ChannelID, "Only admins can manage schedules")
+		return
+	}
+	channelID := parseSnowflake(m.ChannelID)
+	command, arguments := parseCommand(args)
+	var err error
+	switch command {
+	case "add":
+		err = addSchedule(s, m, arguments)
+	case "list":
+		err = listSchedules(s, m)
+	case "pause", "resume", "remove":
+		var id int64
+		if id, err = strconv.ParseInt(strings.TrimSpace(arguments), 10, 64); err != nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Usage: schedule %s <id>", command))
+			return
+		}
+		if command == "remove" {
+			err = schedules.RemoveSchedule(channelID, id)
+		} else {
+			err = schedules.SetPaused(channelID, id, command == "pause")
+		}
+		if err == nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Schedule %d: %sd", id, command))
+		}
+	case "timezone":
+		// timezone names are case sensitive, so take them from the raw message
+		zone := rawArguments(m.Content, 2)
+		if err = schedules.SetTimezone(channelID, zone); err == nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Schedules in this channel now use %s", zone))
+		}
+	default:
+		s.ChannelMessageSend(m.ChannelID, scheduleHelp)
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error handling schedules: %v", err))
+	}
+}
+
+func addSchedule(s *discordgo.Session, m *discordgo.MessageCreate, args string) error {
+	fields := strings.Fields(args)
+	cronFields := 5
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		cronFields = 1
+	}
+	if len(fields) < cronFields+2 {
+		return fmt.Errorf("usage: schedule add <cron> <rule34|redgifs> <tags...>")
+	}
+	expr := strings.Join(fields[:cronFields], " ")
+	if _, err := cron.Parse(expr); err != nil {
+		return err
+	}
+	provider, err := parseProvider(fields[cronFields])
+	if err != nil {
+		return err
+	}
+
+	if err := checkMediaPolicy(s, m.ChannelID, fields[cronFields+1:]); err != nil {
+		return err
+	}
+
+	item := schedules.ScheduleItem{
+		GuildID:   parseSnowflake(m.GuildID),
+		ChannelID: parseSnowflake(m.ChannelID),
+		CreatorID: parseSnowflake(m.Author.ID),
+		Cron:      expr,
+		Provider:  provider,
+		Query:     strings.Join(fields[cronFields+1:], " "),
+	}
+	id, err := schedules.AddSchedule(item)
+	if err != nil {
+		return err
+	}
+	item.ID = id
+	item.LastRun = time.Now()
+	loc, err := schedules.GetTimezone(item.ChannelID)
+	if err != nil {
+		return err
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Schedule %d added, next drop %s", id, formatNextRun(item, loc)))
+	return nil
+}
+
+func listSchedules(s *discordgo.Session, m *discordgo.MessageCreate) error {
+	channelID := parseSnowflake(m.ChannelID)
+	items, err := schedules.GetSchedules(channelID)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "No schedules in this channel")
+		return nil
+	}
+	loc, err := schedules.GetTimezone(channelID)
+	if err != nil {
+		return err
+	}
+	lines := []string{fmt.Sprintf("Schedules (times in %s):", loc)}
+	for _, item := range items {
+		status := "next " + formatNextRun(item, loc)
+		if item.Paused {
+			status = "paused"
+		}
+		lines = append(lines, fmt.Sprintf("%d. `%s` %s `%s` — %s", item.ID, item.Cron, item.Provider, item.Query, status))
+	}
+	s.ChannelMessageSend(m.ChannelID, strings.Join(lines, "\n"))
+	return nil
+}
+
+func formatNextRun(item schedules.ScheduleItem, loc *time.Location) string {
+	sched, err := cron.Parse(item.Cron)
+	if err != nil {
+		return "never (invalid cron)"
+	}
+	next := sched.Next(item.LastRun.In(loc))
+	if next.IsZero() {
+		return "never"
+	}
+	return next.Format("Mon 2 Jan 15:04 MST")
+}
+
+// parseProvider maps the provider names users type to the searcher's name.
+func parseProvider(name string) (string, error) {
+	switch name {
+	case "rule34", "r34":
+		return rule34Provider, nil
+	case "redgifs", "gif":
+		return redgifsProvider, nil
+	default:
+		return "", fmt.Errorf("unknown provider %s, use rule34 or redgifs", name)
+	}
+}
+
+// StartScheduler checks for due schedules every minute and posts a fresh
+// result for each, until stop is closed.
+func StartScheduler(s *discordgo.Session, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				runDueSchedules(s, now)
+			}
+		}
+	}()
+}
+
+func runDueSchedules(s *discordgo.Session, now time.Time) {
+	items, err := schedules.GetActiveSchedules()
+	if err != nil {
+		log.Printf("failed to load schedules: %v", err)
+		return
+	}
+	for _, item := range items {
+		sched, err := cron.Parse(item.Cron)
+		if err != nil {
+			log.Printf("schedule %d has an invalid cron %q: %v", item.ID, item.Cron, err)
+			continue
+		}
+		loc, err := schedules.GetTimezone(item.ChannelID)
+		if err != nil {
+			log.Printf("failed to get timezone for schedule %d: %v", item.ID, err)
+			loc = time.UTC
+		}
+		next := sched.Next(item.LastRun.In(loc))
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		// mark the run first so a slow or failing post isn't repeated every minute
+		if err := schedules.MarkRun(item.ID, now); err != nil {
+			log.Printf("failed to mark schedule %d as run: %v", item.ID, err)
+			continue
+		}
+		postMedia(s, mediaRequest{
+			ChannelID: strconv.FormatInt(item.ChannelID, 10),
+			GuildID:   strconv.FormatInt(item.GuildID, 10),
+			Author:    lookupUser(s, item.CreatorID),
+			Provider:  item.Provider,
+			Count:     1,
+			Query:     item.Query,
+		})
+	}
+}
+
+// lookupUser fetches a user by ID, falling back to a bare user with just the
+// ID so callers can still attribute posts to them.
+func lookupUser(s *discordgo.Session, userID int64) *discordgo.User {
+	id := strconv.FormatInt(userID, 10)
+	user, err := s.User(id)
+	if err != nil {
+		log.Printf("failed to get user %s: %v", id, err)
+		return &discordgo.User{ID: id, Username: "unknown"}
+	}
+	return user
+}
@@ -1,113 +1,548 @@
 package messages
 
 import (
+	"cmp"
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"regexp"
 	"strings"
+	"time"
 
-	"kannonfoundry/whutbot3/api"
+	"kannonfoundry/whutbot3/api/stashdb"
+	"kannonfoundry/whutbot3/api/whisparr"
+	"kannonfoundry/whutbot3/config"
+	"kannonfoundry/whutbot3/db/jobs"
+	"kannonfoundry/whutbot3/db/requests"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-// StashPrefix is the prefix we look for in messages.
+// StashPrefix is the canonical prefix of stashdb scene links.
 const StashPrefix = "https://stashdb.org/scenes"
 
-// ParseStashLink extracts the scene identifier from a stashdb scenes URL.
+// Kinds of stashdb link, as they appear in the URL path.
+const (
+	stashScene     = "scenes"
+	stashPerformer = "performers"
+	stashStudio    = "studios"
+)
+
+// stashLinkPattern matches stashdb scene, performer and studio links with or
+// without the scheme or www, capturing the kind and ID. Wrappers like <...> or
+// markdown links are left outside the match.
+var stashLinkPattern = regexp.MustCompile(`(?i)(?:https?://)?(?:www\.)?stashdb\.org/(scenes|performers|studios)/([^\s/?#<>()\[\]|*_~` + "`" + `]+)`)
+
+// StashLink is a stashdb scene, performer or studio.
+type StashLink struct {
+	Kind string
+	ID   string
+}
+
+// ParseStashLink extracts the kind and identifier from a stashdb URL.
 // Examples it accepts:
 // - https://stashdb.org/scenes/12345
 // - https://stashdb.org/scenes/12345/whatever
-// - https://stashdb.org/scenes/12345?foo=bar
-func ParseStashLink(url string) (string, error) {
-	if !strings.HasPrefix(url, StashPrefix) {
-		return "", errors.New("not a stashdb scenes url")
+// - https://stashdb.org/performers/12345?foo=bar
+// - http://www.stashdb.org/studios/12345
+// - <https://stashdb.org/scenes/12345>
+func ParseStashLink(url string) (StashLink, error) {
+	url = strings.TrimSpace(url)
+	url = strings.TrimSuffix(strings.TrimPrefix(url, "<"), ">")
+	match := stashLinkPattern.FindStringSubmatch(url)
+	if match == nil || !strings.HasPrefix(url, match[0]) {
+		return StashLink{}, errors.New("not a stashdb url")
+	}
+	return StashLink{Kind: strings.ToLower(match[1]), ID: strings.ToLower(match[2])}, nil
+}
+
+// FindStashLinks returns every stashdb link in the message's content, its
+// embeds and any messages forwarded in it, without duplicates and in the order
+// they appear.
+func FindStashLinks(m *discordgo.Message) []StashLink {
+	var links []StashLink
+	seen := map[StashLink]bool{}
+	for _, text := range messageTexts(m) {
+		for _, match := range stashLinkPattern.FindAllStringSubmatch(text, -1) {
+			link := StashLink{Kind: strings.ToLower(match[1]), ID: strings.ToLower(match[2])}
+			if !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+	return links
+}
+
+// messageTexts returns every piece of text in a message that could hold a link.
+func messageTexts(m *discordgo.Message) []string {
+	if m == nil {
+		return nil
+	}
+	texts := []string{m.Content}
+	for _, embed := range m.Embeds {
+		texts = append(texts, embed.URL, embed.Title, embed.Description)
+		for _, field := range embed.Fields {
+			texts = append(texts, field.Value)
+		}
 	}
-	rest := strings.TrimPrefix(url, StashPrefix)
-	rest = strings.TrimPrefix(rest, "/")
-	if rest == "" {
-		return "", errors.New("no scene id in url")
+	for _, snapshot := range m.MessageSnapshots {
+		texts = append(texts, messageTexts(snapshot.Message)...)
 	}
-	// take up to the next slash or query
-	end := len(rest)
-	if i := strings.IndexAny(rest, "/?"); i >= 0 {
-		end = i
+	return texts
+}
+
+// linkOutcome is what happened to a requested scene, performer or studio.
+type linkOutcome string
+
+const (
+	outcomePending  linkOutcome = requests.OutcomePending
+	outcomeAwaiting linkOutcome = requests.OutcomeAwaiting
+	outcomeRetrying linkOutcome = requests.OutcomeRetrying
+	outcomePresent  linkOutcome = requests.OutcomePresent
+	outcomeAdded    linkOutcome = requests.OutcomeAdded
+	outcomeFailed   linkOutcome = requests.OutcomeFailed
+)
+
+// linkResult is the outcome of one link, for the summary reply.
+type linkResult struct {
+	Link    StashLink
+	Title   string
+	Outcome linkOutcome
+	Err     error
+	// Scenes is how many scenes StashDB has for a performer or studio, which is
+	// what monitoring them brings into Whisparr over time, or -1 if unknown.
+	Scenes int
+}
+
+func (r linkResult) String() string {
+	name := r.Link.ID
+	if r.Title != "" {
+		name = fmt.Sprintf("%s (`%s`)", r.Title, r.Link.ID)
+	}
+	if r.Outcome == outcomeFailed {
+		return fmt.Sprintf("❌ %s — failed: %v", name, r.Err)
 	}
-	scene := rest[:end]
-	if scene == "" {
-		return "", errors.New("empty scene id")
+	if r.Link.Kind == stashScene {
+		switch r.Outcome {
+		case outcomePresent:
+			return "✅ " + name + " — already in Whispar"
+		case outcomeAwaiting:
+			return "⏳ " + name + " — waiting for approval"
+		case outcomeRetrying:
+			return fmt.Sprintf("🔁 %s — Whispar is unavailable (%v), will keep trying", name, r.Err)
+		}
+		return "🍑 " + name + " — added to Whispar"
+	}
+	kind, their := "Performer", "their"
+	if r.Link.Kind == stashStudio {
+		kind, their = "Studio", "its"
+	}
+	if r.Outcome == outcomePresent {
+		if r.Scenes < 0 {
+			return fmt.Sprintf("✅ %s %s — already monitored", kind, name)
+		}
+		return fmt.Sprintf("✅ %s %s — already monitored, %d scenes on StashDB", kind, name, r.Scenes)
+	}
+	if r.Scenes < 0 {
+		return fmt.Sprintf("🍑 %s %s — now monitored, Whispar will add %s scenes as it finds them", kind, name, their)
+	}
+	return fmt.Sprintf("🍑 %s %s — now monitored, Whispar will add %s %d scenes on StashDB as it finds them", kind, name, their, r.Scenes)
+}
+
+// StashHandler handles stashdb links by adding their scenes to Whisparr, or
+// monitoring their performers and studios. StashDB is used to preview scenes.
+type StashHandler struct {
+	Whisparr *whisparr.Client
+	StashDB  *stashdb.Client
+	// AdminRoleID is the role allowed to unmonitor and remove scenes; when
+	// empty, server admins are.
+	AdminRoleID string
+	// RetryAttempts and RetryDelay control how scene lookups and adds that
+	// failed because Whisparr was unavailable are retried.
+	RetryAttempts int
+	RetryDelay    time.Duration
+	// ApprovalMode holds scene requests from users without ApproverRoleID
+	// until an approver allows them, in ApprovalChannelID if it is set.
+	ApprovalMode      bool
+	ApproverRoleID    string
+	ApprovalChannelID string
+}
+
+func NewStashHandler(cfg *config.Config) *StashHandler {
+	return &StashHandler{
+		Whisparr:    whisparr.NewClient(cfg),
+		StashDB:     stashdb.NewClient(cfg),
+		AdminRoleID: cfg.WhisparrAdminRoleID,
+
+		RetryAttempts: cfg.WhisparrRetryAttempts,
+		RetryDelay:    time.Duration(cfg.WhisparrRetrySeconds) * time.Second,
+
+		ApprovalMode:      cfg.WhisparrApproval,
+		ApproverRoleID:    cfg.WhisparrApproverRoleID,
+		ApprovalChannelID: cfg.WhisparrApprovalChannelID,
 	}
-	return scene, nil
 }
 
-// HandleStashMessage processes a Discord message and responds when it contains a stashdb link.
+// HandleStashMessage handles the Whisparr channel's commands, and otherwise
+// every stashdb link in the message.
 // It does not filter by channel — the caller should ensure channel filtering if desired.
-func HandleStashMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
+func (h *StashHandler) HandleStashMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 	if m.Author == nil || m.Author.Bot {
 		return
 	}
 
-	// find the first occurrence of the stash prefix in the message content
-	idx := strings.Index(m.Content, StashPrefix)
-	if idx == -1 {
+	command, arguments := parseCommand(m.Content)
+	var err error
+	switch command {
+	case "status":
+		err = h.handleStatusCommand(s, m, arguments)
+	case "queue":
+		err = h.handleQueueCommand(s, m)
+	case "whisparr":
+		err = h.handleWhisparrCommand(s, m, arguments)
+	case "requests":
+		err = h.handleRequestsCommand(s, m, arguments)
+	default:
+		h.handleStashLinks(s, m)
 		return
 	}
-	// extract the candidate URL (up to next whitespace)
-	tail := m.Content[idx:]
-	fields := strings.Fields(tail)
-	if len(fields) == 0 {
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error checking Whispar: %v", err))
+	}
+}
+
+// handleStashLinks handles every stashdb link in the message, replying with
+// one summary line per link.
+func (h *StashHandler) handleStashLinks(s *discordgo.Session, m *discordgo.MessageCreate) {
+	links := FindStashLinks(m.Message)
+	if len(links) == 0 {
 		return
 	}
-	url := fields[0]
+	log.Printf("matched %d stashdb links from %s: %v", len(links), m.Author.Username, links)
 
-	sceneID, err := ParseStashLink(url)
+	if err := s.MessageReactionAdd(m.ChannelID, m.ID, "👀"); err != nil {
+		log.Printf("failed to add reaction: %v", err)
+	}
+
+	opts, err := h.resolveAddOptions(context.Background(), parseAddOptions(m.Content))
 	if err != nil {
-		// not a parseable link — ignore
+		s.ChannelMessageSendReply(m.ChannelID, fmt.Sprintf("Can't add: %v", err), m.Reference())
+		s.MessageReactionRemove(m.ChannelID, m.ID, "👀", "@me")
 		return
 	}
 
-	log.Printf("matched stashdb link from %s: %s (scene=%s)", m.Author.Username, url, sceneID)
+	req := linkRequest{GuildID: m.GuildID, ChannelID: m.ChannelID, MessageID: m.ID, User: m.Author, Member: m.Member, Options: opts}
+	// scenes waiting on a preview get their own reply, so leave them out of the summary
+	var results []linkResult
+	for _, link := range links {
+		if result := h.processLink(context.Background(), s, req, link); result.Outcome != outcomePending {
+			results = append(results, result)
+		}
+	}
+
+	if len(results) > 0 {
+		lines := make([]string, 0, len(results))
+		for _, result := range results {
+			lines = append(lines, result.String())
+		}
+		if _, err := s.ChannelMessageSendReply(m.ChannelID, strings.Join(lines, "\n"), m.Reference()); err != nil {
+			log.Printf("failed to send reply: %v", err)
+		}
+		if err := s.MessageReactionAdd(m.ChannelID, m.ID, summaryReaction(results)); err != nil {
+			log.Printf("failed to add reaction: %v", err)
+		}
+	}
+	if err := s.MessageReactionRemove(m.ChannelID, m.ID, "👀", "@me"); err != nil {
+		log.Printf("failed to remove reaction: %v", err)
+	}
+}
 
-	// acknowledge in-channel
-	_, err = s.ChannelMessageSend(m.ChannelID, "Received stashdb link — processing...")
-	if err != nil {
-		log.Printf("failed to send reply: %v", err)
+// linkRequest is the message that asked for a link to be handled.
+type linkRequest struct {
+	GuildID   string
+	ChannelID string
+	MessageID string
+	User      *discordgo.User
+	Member    *discordgo.Member
+	Options   addOptions
+}
+
+// processLink previews a scene for adding to Whisparr, or monitors a
+// performer or studio.
+func (h *StashHandler) processLink(ctx context.Context, s *discordgo.Session, req linkRequest, link StashLink) linkResult {
+	var result linkResult
+	switch {
+	case link.Kind != stashScene && h.needsApproval(s, req):
+		result = linkResult{Link: link, Outcome: outcomeFailed, Err: errors.New("only approvers can monitor performers and studios while approval is on")}
+	case link.Kind == stashPerformer:
+		result = h.processPerformer(ctx, req, link)
+	case link.Kind == stashStudio:
+		result = h.processStudio(ctx, req, link)
+	default:
+		result = h.processScene(ctx, s, req, link)
 	}
-	// add a peach reaction to the original message
-	if err := s.MessageReactionAdd(m.ChannelID, m.ID, "👀"); err != nil {
-		log.Printf("failed to add reaction: %v", err)
+	if result.Err != nil {
+		log.Printf("failed to process stashdb %s %s: %v", link.Kind, link.ID, result.Err)
 	}
-	// check existence with Whispar
-	exists, err := api.LookupScene(sceneID)
+	return result
+}
+
+// processScene handles a scene link. A scene already in Whisparr is tagged
+// with the requester's name; otherwise a preview is posted and the scene is
+// only added once the requester confirms it. The request is recorded either
+// way, and unless the scene has already been imported the requester is told
+// when it is. If Whisparr can't be reached the lookup is retried later.
+func (h *StashHandler) processScene(ctx context.Context, s *discordgo.Session, req linkRequest, link StashLink) linkResult {
+	result := linkResult{Link: link}
+	movie, err := h.Whisparr.LookupScene(ctx, link.ID)
 	if err != nil {
-		log.Printf("whispar lookup error for scene %s: %v", sceneID, err)
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Error checking scene existence.")
-		return
+		result.Outcome, result.Err = outcomeFailed, fmt.Errorf("error checking scene existence: %w", err)
+		if errors.Is(err, whisparr.ErrNotFound) {
+			// reported as a failure rather than a new scene, as there is nothing to add
+			result.Err = errors.New("scene not found in Whispar")
+		}
+		if whisparr.Unavailable(err) {
+			result.Outcome = outcomeRetrying
+		}
+		id := recordRequest(req, result, false)
+		if result.Outcome == outcomeRetrying {
+			if id == 0 {
+				// there is no request for the retry to pick up
+				result.Outcome = outcomeFailed
+			} else if err := queueRetry(id, jobs.KindLookup, result.Err, h.RetryDelay); err != nil {
+				log.Printf("failed to queue retry for request %d: %v", id, err)
+				result.Outcome = outcomeFailed
+				if err := requests.SetOutcome(id, string(outcomeFailed), "", false); err != nil {
+					log.Printf("failed to update request %d: %v", id, err)
+				}
+			}
+		}
+		return result
 	}
-	if !exists {
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Scene not found in Whispar.")
-		if success, err := api.AddScene(sceneID); success {
-			if err := s.MessageReactionAdd(m.ChannelID, m.ID, "🍑"); err != nil {
-				log.Printf("failed to add reaction: %v", err)
+	return h.continueScene(ctx, s, req, 0, link, movie)
+}
+
+// continueScene carries on with a scene request once Whisparr's lookup has
+// worked. id is the request's ID if it has already been recorded, or 0.
+func (h *StashHandler) continueScene(ctx context.Context, s *discordgo.Session, req linkRequest, id int64, link StashLink, movie whisparr.Movie) linkResult {
+	result := linkResult{Link: link, Title: movie.Title}
+	if movie.InLibrary() {
+		result.Outcome = outcomePresent
+		if tagID := h.requesterTag(ctx, req.User); tagID != 0 {
+			if err := h.Whisparr.TagMovies(ctx, []int{movie.ID}, []int{tagID}); err != nil {
+				log.Printf("failed to tag scene %s: %v", link.ID, err)
 			}
-			if err := s.MessageReactionRemove(m.ChannelID, m.ID, "👀", "@me"); err != nil {
-				log.Printf("failed to remove reaction: %v", err)
+		}
+		saveRequest(req, id, result, movie.HasFile)
+		return result
+	}
+
+	if h.needsApproval(s, req) {
+		result.Outcome = outcomeAwaiting
+		id := saveRequest(req, id, result, false)
+		if id == 0 {
+			// the buttons would have no request to act on
+			result.Outcome, result.Err = outcomeFailed, errors.New("couldn't save the request")
+			return result
+		}
+		if err := h.postApprovalRequest(ctx, s, req, id, movie); err != nil {
+			result.Outcome, result.Err = outcomeFailed, fmt.Errorf("error posting approval request: %w", err)
+			if err := requests.SetOutcome(id, string(outcomeFailed), "", false); err != nil {
+				log.Printf("failed to update request %d: %v", id, err)
 			}
-			_, _ = s.ChannelMessageSend(m.ChannelID, "Added scene to Whispar.")
+		}
+		return result
+	}
+
+	result.Outcome = outcomePending
+	id = saveRequest(req, id, result, false)
+	if id == 0 {
+		result.Outcome, result.Err = outcomeFailed, errors.New("couldn't save the request")
+		return result
+	}
+	if err := h.postScenePreview(ctx, s, req, id, movie); err != nil {
+		result.Outcome, result.Err = outcomeFailed, fmt.Errorf("error posting preview: %w", err)
+		if err := requests.SetOutcome(id, string(outcomeFailed), "", false); err != nil {
+			log.Printf("failed to update request %d: %v", id, err)
+		}
+	}
+	return result
+}
+
+// addScene adds a scene Whisparr doesn't have yet with the request's options,
+// tagged with the requester's name.
+func (h *StashHandler) addScene(ctx context.Context, req linkRequest, link StashLink, movie whisparr.Movie) linkResult {
+	result := linkResult{Link: link, Title: movie.Title}
+	movie.QualityProfileID = cmp.Or(req.Options.QualityProfileID, movie.QualityProfileID)
+	movie.RootFolderPath = cmp.Or(req.Options.RootFolderPath, movie.RootFolderPath)
+	movie.Tags = append(movie.Tags, req.Options.Tags...)
+	if tagID := h.requesterTag(ctx, req.User); tagID != 0 {
+		movie.Tags = append(movie.Tags, tagID)
+	}
+	if _, err := h.Whisparr.AddScene(ctx, movie); err != nil {
+		result.Outcome, result.Err = outcomeFailed, err
+		return result
+	}
+	result.Outcome = outcomeAdded
+	return result
+}
+
+// requesterTag returns the ID of the Whisparr tag named after the user,
+// creating it if needed, or 0 if that fails.
+func (h *StashHandler) requesterTag(ctx context.Context, user *discordgo.User) int {
+	label := tagLabel(user.Username)
+	if label == "" {
+		return 0
+	}
+	tag, err := h.Whisparr.EnsureTag(ctx, label)
+	if err != nil {
+		log.Printf("failed to get Whisparr tag %s: %v", label, err)
+		return 0
+	}
+	return tag.ID
+}
+
+// tagLabel turns a Discord name into a Whisparr tag label, which may only hold
+// lowercase letters, digits and hyphens.
+func tagLabel(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
 		} else {
-			log.Printf("failed to add scene %s: %v", sceneID, err)
-			_, _ = s.ChannelMessageSend(m.ChannelID, "Failed to add scene to Whispar.")
+			b.WriteRune('-')
 		}
-		return
 	}
-	if exists {
-		log.Printf("scene %s exists in Whispar", sceneID)
-		_, _ = s.ChannelMessageSend(m.ChannelID, "Scene already in Whispar.")
-		if err := s.MessageReactionAdd(m.ChannelID, m.ID, "🍑"); err != nil {
-			log.Printf("failed to add reaction: %v", err)
+	return strings.Trim(b.String(), "-")
+}
+
+// recordRequest stores who asked for the scene and what came of it, returning
+// the request's ID. Requests for scenes that were already imported are stored
+// as notified, so the import webhook doesn't announce them.
+func recordRequest(req linkRequest, result linkResult, imported bool) int64 {
+	id, err := requests.AddRequest(requests.RequestItem{
+		ForeignID: result.Link.ID,
+		Title:     result.Title,
+		Outcome:   string(result.Outcome),
+		GuildID:   parseSnowflake(req.GuildID),
+		ChannelID: parseSnowflake(req.ChannelID),
+		MessageID: parseSnowflake(req.MessageID),
+		UserID:    parseSnowflake(req.User.ID),
+
+		QualityProfileID: req.Options.QualityProfileID,
+		RootFolder:       req.Options.RootFolderPath,
+		Tags:             req.Options.Tags,
+		Notified:         imported,
+	})
+	if err != nil {
+		log.Printf("failed to record request for %s: %v", result.Link.ID, err)
+	}
+	return id
+}
+
+// saveRequest records the request like recordRequest, or updates its outcome
+// if it was already recorded with the given ID.
+func saveRequest(req linkRequest, id int64, result linkResult, imported bool) int64 {
+	if id == 0 {
+		return recordRequest(req, result, imported)
+	}
+	if err := requests.SetOutcome(id, string(result.Outcome), result.Title, imported); err != nil {
+		log.Printf("failed to update request %d: %v", id, err)
+	}
+	return id
+}
+
+// processPerformer monitors the performer in Whisparr and counts their scenes
+// on StashDB.
+func (h *StashHandler) processPerformer(ctx context.Context, req linkRequest, link StashLink) linkResult {
+	result := linkResult{Link: link}
+	performer, err := h.Whisparr.LookupPerformer(ctx, link.ID)
+	if err != nil {
+		result.Outcome, result.Err = outcomeFailed, fmt.Errorf("error looking up performer: %w", err)
+		return result
+	}
+	result.Title = performer.FullName
+	result.Outcome = outcomePresent
+	if performer.ID == 0 || !performer.Monitored {
+		performer.QualityProfileID = cmp.Or(req.Options.QualityProfileID, performer.QualityProfileID)
+		performer.RootFolderPath = cmp.Or(req.Options.RootFolderPath, performer.RootFolderPath)
+		performer.Tags = append(performer.Tags, req.Options.Tags...)
+		if _, err := h.Whisparr.MonitorPerformer(ctx, performer); err != nil {
+			result.Outcome, result.Err = outcomeFailed, err
+			return result
 		}
-		if err := s.MessageReactionRemove(m.ChannelID, m.ID, "👀", "@me"); err != nil {
-			log.Printf("failed to remove reaction: %v", err)
+		result.Outcome = outcomeAdded
+	}
+	result.Scenes = h.countScenes(ctx, link)
+	return result
+}
+
+// processStudio monitors the studio in Whisparr and counts its scenes on
+// StashDB.
+func (h *StashHandler) processStudio(ctx context.Context, req linkRequest, link StashLink) linkResult {
+	result := linkResult{Link: link}
+	studio, err := h.Whisparr.LookupStudio(ctx, link.ID)
+	if err != nil {
+		result.Outcome, result.Err = outcomeFailed, fmt.Errorf("error looking up studio: %w", err)
+		return result
+	}
+	result.Title = studio.Title
+	result.Outcome = outcomePresent
+	if studio.ID == 0 || !studio.Monitored {
+		studio.QualityProfileID = cmp.Or(req.Options.QualityProfileID, studio.QualityProfileID)
+		studio.RootFolderPath = cmp.Or(req.Options.RootFolderPath, studio.RootFolderPath)
+		studio.Tags = append(studio.Tags, req.Options.Tags...)
+		if _, err := h.Whisparr.MonitorStudio(ctx, studio); err != nil {
+			result.Outcome, result.Err = outcomeFailed, err
+			return result
 		}
+		result.Outcome = outcomeAdded
+	}
+	result.Scenes = h.countScenes(ctx, link)
+	return result
+}
+
+// countScenes asks StashDB how many scenes a performer or studio has, so the
+// reply can say what monitoring brings in. It returns -1 if StashDB can't say.
+func (h *StashHandler) countScenes(ctx context.Context, link StashLink) int {
+	if h.StashDB == nil {
+		return -1
+	}
+	count := h.StashDB.CountStudioScenes
+	if link.Kind == stashPerformer {
+		count = h.StashDB.CountPerformerScenes
+	}
+	scenes, err := count(ctx, link.ID)
+	if err != nil {
+		log.Printf("failed to count scenes for %s %s: %v", link.Kind, link.ID, err)
+		return -1
+	}
+	return scenes
+}
 
+// summaryReaction is 🍑 when every link was handled, ⏳ when some are
+// waiting for approval or a retry, ❌ when none could be handled, and ⚠️ for a mix.
+func summaryReaction(results []linkResult) string {
+	failed, awaiting := 0, 0
+	for _, result := range results {
+		switch result.Outcome {
+		case outcomeFailed:
+			failed++
+		case outcomeAwaiting, outcomeRetrying:
+			awaiting++
+		}
+	}
+	switch failed {
+	case 0:
+		if awaiting > 0 {
+			return "⏳"
+		}
+		return "🍑"
+	case len(results):
+		return "❌"
+	default:
+		return "⚠️"
 	}
 }
@@ -0,0 +1,201 @@
+package messages
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"kannonfoundry/whutbot3/api/whisparr"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const testSceneID = "2f8ab7e1-5c3d-4b6a-9e0f-1a2b3c4d5e6f"
+
+// whisparrStandIn answers the Whisparr API calls the stash handler makes,
+// recording what was added and tagged.
+type whisparrStandIn struct {
+	mu     sync.Mutex
+	lookup []whisparr.Movie
+	added  []whisparr.Movie
+	tagged [][]int
+}
+
+func (w *whisparrStandIn) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if r.Header.Get("X-Api-Key") != "test-key" {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v3/lookup/scene":
+		if len(w.lookup) == 0 {
+			http.NotFound(rw, r)
+			return
+		}
+		var items []map[string]whisparr.Movie
+		for _, movie := range w.lookup {
+			if movie.ForeignID == r.URL.Query().Get("term") {
+				items = append(items, map[string]whisparr.Movie{"movie": movie})
+			}
+		}
+		json.NewEncoder(rw).Encode(items)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v3/tag":
+		json.NewEncoder(rw).Encode([]whisparr.Tag{{ID: 7, Label: "tester"}})
+	case r.Method == http.MethodPut && r.URL.Path == "/api/v3/movie/editor":
+		var body struct {
+			Tags []int `json:"tags"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.tagged = append(w.tagged, body.Tags)
+		rw.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v3/movie":
+		var movie whisparr.Movie
+		json.NewDecoder(r.Body).Decode(&movie)
+		w.added = append(w.added, movie)
+		movie.ID = 42
+		json.NewEncoder(rw).Encode(movie)
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+// discordStandIn records the messages and reactions the bot sends.
+type discordStandIn struct {
+	mu        sync.Mutex
+	messages  []string
+	reactions []string
+}
+
+func (d *discordStandIn) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case strings.Contains(r.URL.Path, "/reactions/"):
+		if r.Method == http.MethodPut {
+			emoji := strings.Split(strings.SplitAfter(r.URL.Path, "/reactions/")[1], "/")[0]
+			d.reactions = append(d.reactions, emoji)
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/messages"):
+		var msg discordgo.MessageSend
+		json.NewDecoder(r.Body).Decode(&msg)
+		d.messages = append(d.messages, msg.Content)
+		json.NewEncoder(rw).Encode(discordgo.Message{ID: "100", ChannelID: "1"})
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+func newTestStashHandler(t *testing.T, lookup ...whisparr.Movie) (*StashHandler, *whisparrStandIn, *discordgo.Session, *discordStandIn) {
+	t.Helper()
+	// requests can't be recorded without a database, which the handler logs and carries on from
+	t.Setenv("DATABASE_URL", "postgres://127.0.0.1:1/test?connect_timeout=1")
+
+	w := &whisparrStandIn{lookup: lookup}
+	whisparrServer := httptest.NewServer(w)
+	t.Cleanup(whisparrServer.Close)
+
+	d := &discordStandIn{}
+	discordServer := httptest.NewServer(d)
+	t.Cleanup(discordServer.Close)
+	channels := discordgo.EndpointChannels
+	discordgo.EndpointChannels = discordServer.URL + "/channels/"
+	t.Cleanup(func() { discordgo.EndpointChannels = channels })
+
+	s, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &StashHandler{
+		Whisparr: &whisparr.Client{
+			BaseURL:          whisparrServer.URL,
+			APIKey:           "test-key",
+			RootFolder:       "/data",
+			QualityProfileID: 1,
+			HTTPClient:       whisparrServer.Client(),
+		},
+	}
+	return h, w, s, d
+}
+
+func testStashMessage(content string) *discordgo.MessageCreate {
+	return &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        "10",
+		ChannelID: "1",
+		GuildID:   "2",
+		Content:   content,
+		Author:    &discordgo.User{ID: "3", Username: "tester"},
+	}}
+}
+
+func TestHandleStashMessageSceneInLibrary(t *testing.T) {
+	h, w, s, d := newTestStashHandler(t, whisparr.Movie{ID: 5, Title: "Some Scene", ForeignID: testSceneID})
+
+	h.HandleStashMessage(s, testStashMessage("https://stashdb.org/scenes/"+testSceneID))
+
+	if len(d.messages) != 1 || !strings.Contains(d.messages[0], "Some Scene") || !strings.Contains(d.messages[0], "already in Whispar") {
+		t.Fatalf("replies = %q, want one saying the scene is already in Whispar", d.messages)
+	}
+	if len(w.added) != 0 {
+		t.Errorf("added %d scenes, want none", len(w.added))
+	}
+	if len(w.tagged) != 1 || !slices.Equal(w.tagged[0], []int{7}) {
+		t.Errorf("tagged = %v, want the requester's tag", w.tagged)
+	}
+	if !slices.Contains(d.reactions, "🍑") {
+		t.Errorf("reactions = %q, want 🍑", d.reactions)
+	}
+}
+
+func TestHandleStashMessageSceneNotFound(t *testing.T) {
+	h, w, s, d := newTestStashHandler(t)
+
+	h.HandleStashMessage(s, testStashMessage("https://stashdb.org/scenes/"+testSceneID))
+
+	if len(d.messages) != 1 || !strings.Contains(d.messages[0], "scene not found in Whispar") {
+		t.Fatalf("replies = %q, want one saying the scene wasn't found", d.messages)
+	}
+	if len(w.added) != 0 {
+		t.Errorf("added %d scenes, want none", len(w.added))
+	}
+	if !slices.Contains(d.reactions, "❌") {
+		t.Errorf("reactions = %q, want ❌", d.reactions)
+	}
+}
+
+func TestStashHandlerAddScene(t *testing.T) {
+	movie := whisparr.Movie{Title: "Some Scene", ForeignID: testSceneID}
+	h, w, _, _ := newTestStashHandler(t, movie)
+	req := linkRequest{
+		User:    &discordgo.User{ID: "3", Username: "tester"},
+		Options: addOptions{QualityProfileID: 3, Tags: []int{9}},
+	}
+
+	result := h.addScene(context.Background(), req, StashLink{Kind: stashScene, ID: testSceneID}, movie)
+
+	if result.Outcome != outcomeAdded || result.Err != nil {
+		t.Fatalf("outcome = %q, err = %v, want added", result.Outcome, result.Err)
+	}
+	if len(w.added) != 1 {
+		t.Fatalf("added %d scenes, want 1", len(w.added))
+	}
+	added := w.added[0]
+	if added.ForeignID != testSceneID || !added.Monitored || added.AddOptions == nil || !added.AddOptions.SearchForMovie {
+		t.Errorf("added %+v, want the scene monitored with a search", added)
+	}
+	if added.QualityProfileID != 3 || added.RootFolderPath != "/data" {
+		t.Errorf("quality profile %d, root folder %q, want the request's profile and the default folder", added.QualityProfileID, added.RootFolderPath)
+	}
+	if !slices.Equal(added.Tags, []int{9, 7}) {
+		t.Errorf("tags = %v, want the request's tags and the requester's", added.Tags)
+	}
+}
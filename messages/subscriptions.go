@@ -0,0 +1,235 @@
+package messages
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"kannonfoundry/whutbot3/api"
+	"kannonfoundry/whutbot3/config"
+	"kannonfoundry/whutbot3/db/aliases"
+	"kannonfoundry/whutbot3/db/sent"
+	"kannonfoundry/whutbot3/db/subscriptions"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const subscriptionsHelp = "Available subscriptions commands: list, remove <id>. Subscribe with: subscribe <tags...>"
+
+// handleSubscribeCommand subscribes the channel to new rule34 posts matching
+// the tags. Posts already uploaded when subscribing are not posted.
+func handleSubscribeCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) {
+	if !isModerator(s, m.Author.ID, m.ChannelID) {
+		s.ChannelMessageSend(m.ChannelID, "Only moderators can manage subscriptions")
+		return
+	}
+	if strings.TrimSpace(args) == "" {
+		s.ChannelMessageSend(m.ChannelID, "Usage: subscribe <tags...>")
+		return
+	}
+	if err := checkMediaPolicy(s, m.ChannelID, strings.Fields(args)); err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Can't subscribe: %v", err))
+		return
+	}
+	item := subscriptions.SubscriptionItem{
+		GuildID:   parseSnowflake(m.GuildID),
+		ChannelID: parseSnowflake(m.ChannelID),
+		CreatorID: parseSnowflake(m.Author.ID),
+		Provider:  rule34Provider,
+		Query:     strings.TrimSpace(args),
+	}
+
+	// start the cursor at the newest existing post
+	searcher, tags, err := subscriptionSearch(item)
+	if err == nil {
+		item.LastSeenID, err = latestPostID(searcher, tags)
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error handling subscriptions: %v", err))
+		return
+	}
+
+	id, err := subscriptions.AddSubscription(item)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error handling subscriptions: %v", err))
+		return
+	}
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Subscription %d added, new posts for `%s` will show up here", id, item.Query))
+}
+
+func handleSubscriptionsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) {
+	channelID := parseSnowflake(m.ChannelID)
+	command, arguments := parseCommand(args)
+	var err error
+	switch command {
+	case "list", "":
+		var items subscriptions.SubscriptionItems
+		if items, err = subscriptions.GetSubscriptions(channelID); err == nil {
+			if len(items) == 0 {
+				s.ChannelMessageSend(m.ChannelID, "No subscriptions in this channel")
+				break
+			}
+			lines := []string{"Subscriptions:"}
+			for _, item := range items {
+				lines = append(lines, fmt.Sprintf("%d. %s `%s` (last seen #%d)", item.ID, item.Provider, item.Query, item.LastSeenID))
+			}
+			s.ChannelMessageSend(m.ChannelID, strings.Join(lines, "\n"))
+		}
+	case "remove":
+		if !isModerator(s, m.Author.ID, m.ChannelID) {
+			s.ChannelMessageSend(m.ChannelID, "Only moderators can manage subscriptions")
+			return
+		}
+		var id int64
+		if id, err = strconv.ParseInt(strings.TrimSpace(arguments), 10, 64); err != nil {
+			s.ChannelMessageSend(m.ChannelID, "Usage: subscriptions remove <id>")
+			return
+		}
+		if err = subscriptions.RemoveSubscription(channelID, id); err == nil {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Subscription %d removed", id))
+		}
+	default:
+		s.ChannelMessageSend(m.ChannelID, subscriptionsHelp)
+	}
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Error handling subscriptions: %v", err))
+	}
+}
+
+// StartSubscriptionPoller checks every subscription for new posts on the
+// configured interval, until stop is closed.
+func StartSubscriptionPoller(s *discordgo.Session, cfg *config.Config, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(max(cfg.SubscriptionPollMinutes, 1)) * time.Minute)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				pollSubscriptions(s, cfg.SubscriptionMaxPosts)
+			}
+		}
+	}()
+}
+
+func pollSubscriptions(s *discordgo.Session, maxPosts int) {
+	items, err := subscriptions.GetSubscriptions(0)
+	if err != nil {
+		log.Printf("failed to load subscriptions: %v", err)
+		return
+	}
+	for _, item := range items {
+		if err := pollSubscription(s, item, maxPosts); err != nil {
+			log.Printf("failed to poll subscription %d: %v", item.ID, err)
+		}
+	}
+}
+
+// pollSubscription posts up to maxPosts of the subscription's new posts,
+// oldest first, and moves its cursor past them. SearchSince returns the
+// oldest new posts, so anything beyond maxPosts is left for the next poll
+// rather than skipped.
+func pollSubscription(s *discordgo.Session, item subscriptions.SubscriptionItem, maxPosts int) error {
+	channelID := strconv.FormatInt(item.ChannelID, 10)
+	if err := checkMediaPolicy(s, channelID, strings.Fields(item.Query)); err != nil {
+		return err
+	}
+	files, err := searchSince(item, item.LastSeenID)
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(files, func(a, b api.Media) int {
+		return cmp.Compare(contentID(a), contentID(b))
+	})
+	if len(files) > maxPosts {
+		files = files[:maxPosts]
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	sentDB, err := sent.NewSentDB()
+	if err != nil {
+		return err
+	}
+	defer sentDB.Close()
+
+	guildID := strconv.FormatInt(item.GuildID, 10)
+	sizeLimit := uploadSizeLimit(s, guildID)
+	downloads, err := collectUnsentFiles(files, len(files), sizeLimit, sentDB)
+	if err != nil {
+		return err
+	}
+	if len(downloads) > 0 {
+		req := mediaRequest{
+			ChannelID: channelID,
+			GuildID:   guildID,
+			Author:    lookupUser(s, item.CreatorID),
+			Provider:  item.Provider,
+			Count:     len(downloads),
+			Query:     item.Query,
+		}
+		if err := sendFiles(s, channelID, downloads, sizeLimit, resultContext{Request: req, SearchTerm: item.Query}); err != nil {
+			// the cursor stays put, so let the next poll pick these again
+			unmarkSent(sentDB, downloads)
+			return err
+		}
+	}
+	return subscriptions.AdvanceCursor(item.ID, contentID(files[len(files)-1]))
+}
+
+// searchSince runs the subscription's query, with the creator's aliases and
+// preferences applied, for posts newer than sinceID.
+func searchSince(item subscriptions.SubscriptionItem, sinceID int64) ([]api.Media, error) {
+	searcher, tags, err := subscriptionSearch(item)
+	if err != nil {
+		return nil, err
+	}
+	return searcher.(api.NewPostsSearcher).SearchSince(tags, sinceID)
+}
+
+// subscriptionSearch returns the subscription's searcher and its query with
+// the creator's aliases and preferences applied.
+func subscriptionSearch(item subscriptions.SubscriptionItem) (api.MediaSearcher, []string, error) {
+	searcher := newSearcher(item.Provider)
+	if _, ok := searcher.(api.NewPostsSearcher); !ok {
+		return nil, nil, fmt.Errorf("%s doesn't support subscriptions", item.Provider)
+	}
+	tags, err := aliases.Expand(strings.Fields(item.Query), item.CreatorID, item.GuildID)
+	if err != nil {
+		return nil, nil, err
+	}
+	searchTerm, err := searcher.FormatAndModifySearch(tags, item.CreatorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return searcher, strings.Fields(searchTerm), nil
+}
+
+// latestPostID returns the ID of the newest post matching the tags, or 0 if
+// there are none. It uses a plain search, which lists the newest posts first,
+// since SearchSince lists the oldest.
+func latestPostID(searcher api.MediaSearcher, tags []string) (int64, error) {
+	files, err := searcher.Search(tags)
+	if isEmptySearch(files, err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	for _, file := range files {
+		latest = max(latest, contentID(file))
+	}
+	return latest, nil
+}
+
+func contentID(file api.Media) int64 {
+	id, _ := strconv.ParseInt(file.ID, 10, 64)
+	return id
+}
@@ -0,0 +1,63 @@
+package messages
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"kannonfoundry/whutbot3/api"
+)
+
+// fakeSearcher returns files for any search, newest first like the real
+// providers, and records the tags it was asked for.
+type fakeSearcher struct {
+	files    []api.Media
+	err      error
+	searched [][]string
+}
+
+func (f *fakeSearcher) Search(tags []string) ([]api.Media, error) {
+	f.searched = append(f.searched, tags)
+	return f.files, f.err
+}
+
+func (f *fakeSearcher) FormatAndModifySearch(tags []string, authorID int64) (string, error) {
+	return strings.Join(tags, " "), nil
+}
+
+func (f *fakeSearcher) SearchSince(tags []string, sinceID int64) ([]api.Media, error) {
+	return nil, errors.New("the cursor shouldn't be seeded from SearchSince")
+}
+
+func TestLatestPostID(t *testing.T) {
+	searcher := &fakeSearcher{files: []api.Media{{ID: "900"}, {ID: "950"}, {ID: "870"}}}
+
+	latest, err := latestPostID(searcher, []string{"cat", "-dog"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != 950 {
+		t.Errorf("latest = %d, want the highest ID, 950", latest)
+	}
+	if len(searcher.searched) != 1 || !slices.Equal(searcher.searched[0], []string{"cat", "-dog"}) {
+		t.Errorf("searched %q, want one plain search for the tags", searcher.searched)
+	}
+}
+
+func TestLatestPostIDNoResults(t *testing.T) {
+	for _, searcher := range []*fakeSearcher{{}, {err: api.ErrNoResults}} {
+		latest, err := latestPostID(searcher, []string{"cat"})
+		if err != nil || latest != 0 {
+			t.Errorf("latest = %d, err = %v, want 0 and no error", latest, err)
+		}
+	}
+}
+
+func TestLatestPostIDError(t *testing.T) {
+	searcher := &fakeSearcher{err: errors.New("boom")}
+
+	if _, err := latestPostID(searcher, []string{"cat"}); err == nil {
+		t.Error("want the search error")
+	}
+}
@@ -0,0 +1,233 @@
+package messages
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"kannonfoundry/whutbot3/api"
+	"kannonfoundry/whutbot3/db/posts"
+	"kannonfoundry/whutbot3/db/sent"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// defaultUploadSize is the upload limit, in total per message, for guilds
+	// without enough boosts to raise it.
+	defaultUploadSize = 8 * 1024 * 1024
+	// maxAttachmentsPerMessage is Discord's limit on files attached to one message.
+	maxAttachmentsPerMessage = 10
+	// maxEmbedsPerMessage is Discord's limit on embeds in one message.
+	maxEmbedsPerMessage = 10
+)
+
+// downloadedFile is a result ready to post. Data is empty when no rendition
+// fit within the upload limit, in which case the original is linked instead.
+type downloadedFile struct {
+	Media api.Media
+	Name  string
+	Data  []byte
+}
+
+// resultContext describes the request that produced a set of results.
+type resultContext struct {
+	Request    mediaRequest
+	SearchTerm string
+}
+
+func (f downloadedFile) tooLarge() bool {
+	return f.Data == nil
+}
+
+// uploadSizeLimit returns the largest upload Discord accepts in the guild,
+// which depends on its boost tier.
+func uploadSizeLimit(s *discordgo.Session, guildID string) int64 {
+	if guildID == "" {
+		return defaultUploadSize
+	}
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		if guild, err = s.Guild(guildID); err != nil {
+			log.Printf("failed to get guild %s: %v", guildID, err)
+			return defaultUploadSize
+		}
+	}
+	switch guild.PremiumTier {
+	case discordgo.PremiumTier2:
+		return 50 * 1024 * 1024
+	case discordgo.PremiumTier3:
+		return 100 * 1024 * 1024
+	default:
+		return defaultUploadSize
+	}
+}
+
+// collectUnsentFiles downloads up to count files that haven't been sent before.
+// When a file is over sizeLimit its smaller renditions are tried in order, and
+// if none of them fit the file is returned without data so it can be linked.
+// Every file picked is marked as sent so it isn't tried again; callers
+// unmarkSent them if posting fails. Files carrying a forbidden tag are skipped.
+func collectUnsentFiles(files []api.Media, count int, sizeLimit int64, sentDB *sent.SentDB) ([]downloadedFile, error) {
+	var downloads []downloadedFile
+	for _, file := range files {
+		if len(downloads) == count {
+			break
+		}
+		if isForbiddenMedia(file) {
+			continue
+		}
+		beenSent, err := sentDB.HasBeenSent(file.URL)
+		if err != nil {
+			return downloads, fmt.Errorf("Error checking sent database: %v", err)
+		}
+		if beenSent {
+			continue
+		}
+		if err := sentDB.MarkAsSent(file.URL); err != nil {
+			return downloads, fmt.Errorf("Error marking post as sent: %v", err)
+		}
+
+		downloads = append(downloads, downloadMedia(file, sizeLimit))
+	}
+	return downloads, nil
+}
+
+// unmarkSent lets files collectUnsentFiles picked be picked again, when
+// posting them failed.
+func unmarkSent(sentDB *sent.SentDB, files []downloadedFile) {
+	for _, file := range files {
+		if err := sentDB.UnmarkSent(file.Media.URL); err != nil {
+			log.Printf("failed to unmark %s: %v", file.Media.URL, err)
+		}
+	}
+}
+
+// downloadMedia fetches the first of the file's renditions that fits within
+// sizeLimit, leaving the data empty if none do.
+func downloadMedia(file api.Media, sizeLimit int64) downloadedFile {
+	download := downloadedFile{Media: file}
+	for _, rendition := range append([]string{file.URL}, file.Renditions...) {
+		data, err := fetchWithin(rendition, sizeLimit)
+		if err != nil {
+			log.Printf("error fetching %s: %v", rendition, err)
+			continue
+		}
+		if data != nil {
+			download.Name = attachmentName(file, rendition)
+			download.Data = data
+			break
+		}
+	}
+	return download
+}
+
+// fetchWithin downloads fileUrl, returning nil data when it is larger than sizeLimit.
+func fetchWithin(fileUrl string, sizeLimit int64) ([]byte, error) {
+	req, err := http.NewRequest("GET", fileUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating HTTP request: %v", err)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch file: %s", resp.Status)
+	}
+	if resp.Header.Get("Content-Length") != "" && resp.ContentLength > sizeLimit {
+		return nil, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, sizeLimit+1))
+	if err != nil {
+		return nil, fmt.Errorf("Error downloading file: %v", err)
+	}
+	if int64(len(data)) > sizeLimit {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// sendFiles posts the files with an embed describing each one, packing as
+// many into each message as Discord's attachment count and total size limits
+// allow. Files too large to upload, or rejected by Discord as too large, are
+// posted as embeds linking the original.
+func sendFiles(s *discordgo.Session, channelID string, files []downloadedFile, sizeLimit int64, rc resultContext) error {
+	for _, batch := range batchFiles(files, sizeLimit) {
+		msg, err := s.ChannelMessageSendComplex(channelID, resultMessage(batch, rc))
+		if err != nil && strings.Contains(err.Error(), "entity too large") {
+			for i := range batch {
+				batch[i].Data = nil
+			}
+			msg, err = s.ChannelMessageSendComplex(channelID, resultMessage(batch, rc))
+		}
+		if err != nil {
+			return err
+		}
+		if err := recordResults(msg, batch, rc); err != nil {
+			log.Printf("failed to record posted results: %v", err)
+		}
+	}
+	return nil
+}
+
+// recordResults stores what was posted in msg so its buttons and reactions
+// can be handled later.
+func recordResults(msg *discordgo.Message, batch []downloadedFile, rc resultContext) error {
+	rememberMessage(msg.ID, true)
+	var items posts.PostItems
+	for _, file := range batch {
+		items = append(items, posts.PostItem{
+			MessageID:   parseSnowflake(msg.ID),
+			ChannelID:   parseSnowflake(msg.ChannelID),
+			RequesterID: parseSnowflake(rc.Request.Author.ID),
+			Provider:    file.Media.Provider,
+			ContentID:   file.Media.ID,
+			URL:         file.Media.URL,
+			Tags:        file.Media.Tags,
+			Query:       rc.Request.Query,
+		})
+	}
+	return posts.RecordPosts(items)
+}
+
+func batchFiles(files []downloadedFile, sizeLimit int64) [][]downloadedFile {
+	var batches [][]downloadedFile
+	var current []downloadedFile
+	var currentSize int64
+	for _, file := range files {
+		size := int64(len(file.Data))
+		if len(current) == min(maxAttachmentsPerMessage, maxEmbedsPerMessage) || (len(current) > 0 && currentSize+size > sizeLimit) {
+			batches = append(batches, current)
+			current = nil
+			currentSize = 0
+		}
+		current = append(current, file)
+		currentSize += size
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// attachmentName builds a readable file name for a rendition, keeping the
+// extension from its URL so Discord can preview it.
+func attachmentName(media api.Media, rendition string) string {
+	ext := ""
+	if u, err := url.Parse(rendition); err == nil {
+		ext = path.Ext(u.Path)
+	}
+	if media.ID == "" {
+		return path.Base(rendition)
+	}
+	return fmt.Sprintf("%s_%s%s", media.Provider, media.ID, ext)
+}
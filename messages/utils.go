@@ -1,7 +1,11 @@
 package messages
 
 import (
+	"log"
+	"strconv"
 	"strings"
+
+	"github.com/bwmarrin/discordgo"
 )
 
 func parseCommand(input string) (command string, arguments string) {
@@ -11,3 +15,51 @@ func parseCommand(input string) (command string, arguments string) {
 	}
 	return strings.ToLower(parts[0]), ""
 }
+
+// isModerator reports whether the user can manage messages in the channel.
+func isModerator(s *discordgo.Session, userID string, channelID string) bool {
+	perms, err := s.UserChannelPermissions(userID, channelID)
+	if err != nil {
+		log.Printf("failed to get permissions for %s: %v", userID, err)
+		return false
+	}
+	return perms&discordgo.PermissionManageMessages != 0
+}
+
+// parseSnowflake parses a Discord ID, returning 0 when it is empty (e.g. the
+// guild ID of a direct message).
+func parseSnowflake(id string) int64 {
+	if id == "" {
+		return 0
+	}
+	v, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		log.Printf("error parsing ID %q: %v", id, err)
+		return 0
+	}
+	return v
+}
+
+// rawArguments returns input with its first n words removed, keeping the
+// original case (parseCommand lowercases everything).
+func rawArguments(input string, n int) string {
+	rest := strings.TrimSpace(input)
+	for range n {
+		_, after, found := strings.Cut(rest, " ")
+		if !found {
+			return ""
+		}
+		rest = strings.TrimSpace(after)
+	}
+	return rest
+}
+
+// isAdmin reports whether the user can manage the server the channel is in.
+func isAdmin(s *discordgo.Session, userID string, channelID string) bool {
+	perms, err := s.UserChannelPermissions(userID, channelID)
+	if err != nil {
+		log.Printf("failed to get permissions for %s: %v", userID, err)
+		return false
+	}
+	return perms&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) != 0
+}
@@ -0,0 +1,157 @@
+package messages
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kannonfoundry/whutbot3/api/whisparr"
+	"kannonfoundry/whutbot3/config"
+	"kannonfoundry/whutbot3/db/requests"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// WebhookPath is where Whisparr's webhook connection should point.
+const WebhookPath = "/whisparr/webhook"
+
+// maxWebhookBody bounds the size of a notification we'll read.
+const maxWebhookBody = 1 << 20
+
+// StartWebhookServer listens for Whisparr's webhook notifications until stop
+// is closed. It does nothing when no address is configured.
+func StartWebhookServer(s *discordgo.Session, cfg *config.Config, stop <-chan struct{}) {
+	if cfg.WhisparrWebhookAddr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(WebhookPath, NewWebhookHandler(s, cfg))
+	srv := &http.Server{
+		Addr:              cfg.WhisparrWebhookAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Printf("listening for Whisparr webhooks on %s%s", cfg.WhisparrWebhookAddr, WebhookPath)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("webhook server failed: %v", err)
+		}
+	}()
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+}
+
+// NewWebhookHandler returns a handler for Whisparr's webhook notifications.
+// Imports are announced to whoever requested the scene, in reply to their
+// request, and health issues go to the log channel.
+func NewWebhookHandler(s *discordgo.Session, cfg *config.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !webhookAuthorized(r, cfg.WhisparrWebhookSecret) {
+			log.Printf("rejected webhook from %s: bad secret", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var event whisparr.WebhookEvent
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(&event); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		handleWebhookEvent(s, cfg, event)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// webhookAuthorized checks the shared secret, sent as the basic auth password
+// (Whisparr's webhook username/password settings) or the secret query parameter.
+func webhookAuthorized(r *http.Request, secret string) bool {
+	if secret == "" {
+		return true
+	}
+	given := r.URL.Query().Get("secret")
+	if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(secret)) == 1
+}
+
+func handleWebhookEvent(s *discordgo.Session, cfg *config.Config, event whisparr.WebhookEvent) {
+	switch event.EventType {
+	case whisparr.EventTest:
+		log.Printf("received Whisparr test notification")
+	case whisparr.EventHealth:
+		msg := fmt.Sprintf("Whispar health (%s): %s", event.Level, event.Message)
+		if event.WikiURL != "" {
+			msg += fmt.Sprintf(" <%s>", event.WikiURL)
+		}
+		s.ChannelMessageSend(cfg.LogChannelID, msg)
+	case whisparr.EventGrab:
+		if event.Movie == nil {
+			return
+		}
+		msg := fmt.Sprintf("⬇️ Grabbed %s", event.Movie.Title)
+		if event.Release != nil && event.Release.Quality != "" {
+			msg += fmt.Sprintf(" (%s)", event.Release.Quality)
+		}
+		notifyRequesters(s, event.Movie.ForeignID, msg, false)
+	case whisparr.EventDownload:
+		if event.Movie == nil {
+			return
+		}
+		msg := fmt.Sprintf("🍑 %s has been imported", event.Movie.Title)
+		if event.MovieFile != nil && event.MovieFile.Quality != "" {
+			msg += fmt.Sprintf(" (%s)", event.MovieFile.Quality)
+		}
+		notifyRequesters(s, event.Movie.ForeignID, msg, true)
+	}
+}
+
+// notifyRequesters replies to every pending request for the scene. Imports
+// mention the requester and close the request; grabs are posted quietly.
+func notifyRequesters(s *discordgo.Session, foreignID string, msg string, imported bool) {
+	items, err := requests.GetPendingRequests(foreignID)
+	if err != nil {
+		log.Printf("failed to get requests for %s: %v", foreignID, err)
+		return
+	}
+	for _, item := range items {
+		channelID := strconv.FormatInt(item.ChannelID, 10)
+		content := msg
+		mentions := &discordgo.MessageAllowedMentions{}
+		if imported {
+			content = fmt.Sprintf("<@%d> %s", item.UserID, msg)
+			mentions.Users = []string{strconv.FormatInt(item.UserID, 10)}
+		}
+		_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content: content,
+			Reference: &discordgo.MessageReference{
+				MessageID:       strconv.FormatInt(item.MessageID, 10),
+				ChannelID:       channelID,
+				GuildID:         strconv.FormatInt(item.GuildID, 10),
+				FailIfNotExists: new(bool),
+			},
+			AllowedMentions: mentions,
+		})
+		if err != nil {
+			log.Printf("failed to notify request %d: %v", item.ID, err)
+			continue
+		}
+		if imported {
+			if err := requests.MarkNotified(item.ID); err != nil {
+				log.Printf("failed to mark request %d notified: %v", item.ID, err)
+			}
+		}
+	}
+}
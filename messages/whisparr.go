@@ -0,0 +1,368 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"kannonfoundry/whutbot3/api/whisparr"
+	"kannonfoundry/whutbot3/db/jobs"
+	"kannonfoundry/whutbot3/db/requests"
+	"kannonfoundry/whutbot3/fuzzy"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxQueueLines caps how many downloads "queue" lists, to stay under
+// Discord's message length limit.
+const maxQueueLines = 15
+
+const whisparrHelp = "Available whisparr commands: profiles, folders, tags, search <link>, unmonitor <link>, remove <link> [--files], retries"
+
+func (h *StashHandler) handleWhisparrCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) error {
+	command, arguments := parseCommand(args)
+	ctx := context.Background()
+	var lines []string
+	switch command {
+	case "search":
+		return h.handleSearchCommand(s, m, arguments)
+	case "unmonitor":
+		return h.handleUnmonitorCommand(s, m, arguments)
+	case "remove":
+		return h.handleRemoveCommand(s, m, arguments)
+	case "profiles":
+		profiles, err := h.Whisparr.QualityProfiles(ctx)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, "Quality profiles (use with `quality:<name>`):")
+		for _, profile := range profiles {
+			lines = append(lines, "- "+profile.Name)
+		}
+	case "folders":
+		folders, err := h.Whisparr.RootFolders(ctx)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, "Root folders (use with `folder:<name>`):")
+		for _, folder := range folders {
+			lines = append(lines, fmt.Sprintf("- %s (%s free)", folder.Path, formatSize(folder.FreeSpace)))
+		}
+	case "tags":
+		tags, err := h.Whisparr.Tags(ctx)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, "Tags (use with `tag:<name>`):")
+		for _, tag := range tags {
+			lines = append(lines, "- "+tag.Label)
+		}
+	case "retries":
+		for _, status := range []string{jobs.StatusQueued, jobs.StatusDead} {
+			items, err := jobs.GetJobs(status, requestsListSize)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, fmt.Sprintf("%s jobs:", strings.ToUpper(status[:1])+status[1:]))
+			if len(items) == 0 {
+				lines = append(lines, "- none")
+			}
+			for _, item := range items {
+				lines = append(lines, formatJob(item))
+			}
+		}
+	default:
+		lines = append(lines, whisparrHelp)
+	}
+	s.ChannelMessageSend(m.ChannelID, strings.Join(lines, "\n"))
+	return nil
+}
+
+// formatJob describes a retried Whisparr operation for "whisparr retries".
+func formatJob(item jobs.JobItem) string {
+	line := fmt.Sprintf("- %s for request %d, %d attempts: %s", item.Kind, item.RequestID, item.Attempts, item.LastError)
+	if item.Status == jobs.StatusQueued {
+		line += fmt.Sprintf(" (next <t:%d:R>)", item.NextRun.Unix())
+	}
+	return line
+}
+
+// requestsListSize is how many requests "requests mine" and "requests recent" show.
+const requestsListSize = 10
+
+// handleRequestsCommand lists the author's own or everyone's recent scene requests.
+func (h *StashHandler) handleRequestsCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) error {
+	command, _ := parseCommand(args)
+	var items requests.RequestItems
+	var err error
+	var heading string
+	switch command {
+	case "mine", "":
+		heading = "Your recent requests:"
+		items, err = requests.GetUserRequests(parseSnowflake(m.Author.ID), requestsListSize)
+	case "recent":
+		heading = "Recent requests:"
+		items, err = requests.GetRecentRequests(parseSnowflake(m.GuildID), requestsListSize)
+	default:
+		s.ChannelMessageSend(m.ChannelID, "Available requests commands: mine, recent")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "No requests yet.")
+		return nil
+	}
+	lines := []string{heading}
+	for _, item := range items {
+		title := item.Title
+		if title == "" {
+			title = "`" + item.ForeignID + "`"
+		}
+		lines = append(lines, fmt.Sprintf("<t:%d:R> %s — %s by <@%d>", item.Time.Unix(), title, item.Outcome, item.UserID))
+	}
+	// list requesters without pinging them
+	_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content:         strings.Join(lines, "\n"),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	return err
+}
+
+// addOptions overrides the quality profile, root folder and tags requested
+// scenes, performers and studios are added with.
+type addOptions struct {
+	QualityProfileID int
+	RootFolderPath   string
+	Tags             []int
+}
+
+// parseAddOptions picks the quality:, folder: and tag: options out of a
+// message, e.g. "quality:4K folder:archive". tag: may be given more than once.
+func parseAddOptions(content string) map[string][]string {
+	options := map[string][]string{}
+	for _, field := range strings.Fields(content) {
+		key, value, found := strings.Cut(field, ":")
+		key = strings.ToLower(key)
+		if !found || value == "" {
+			continue
+		}
+		switch key {
+		case "quality", "folder", "tag":
+			options[key] = append(options[key], value)
+		}
+	}
+	return options
+}
+
+// resolveAddOptions looks the named options up in Whisparr, rejecting unknown
+// names with suggestions.
+func (h *StashHandler) resolveAddOptions(ctx context.Context, raw map[string][]string) (addOptions, error) {
+	var opts addOptions
+	if names := raw["quality"]; len(names) > 0 {
+		profiles, err := h.Whisparr.QualityProfiles(ctx)
+		if err != nil {
+			return opts, err
+		}
+		var candidates []string
+		for _, profile := range profiles {
+			candidates = append(candidates, profile.Name)
+			if strings.EqualFold(profile.Name, names[0]) {
+				opts.QualityProfileID = profile.ID
+			}
+		}
+		if opts.QualityProfileID == 0 {
+			return opts, unknownOptionError("quality profile", names[0], candidates, "whisparr profiles")
+		}
+	}
+	if names := raw["folder"]; len(names) > 0 {
+		folders, err := h.Whisparr.RootFolders(ctx)
+		if err != nil {
+			return opts, err
+		}
+		var candidates []string
+		for _, folder := range folders {
+			base := path.Base(strings.TrimSuffix(folder.Path, "/"))
+			candidates = append(candidates, base)
+			if strings.EqualFold(folder.Path, names[0]) || strings.EqualFold(base, names[0]) {
+				opts.RootFolderPath = folder.Path
+			}
+		}
+		if opts.RootFolderPath == "" {
+			return opts, unknownOptionError("root folder", names[0], candidates, "whisparr folders")
+		}
+	}
+	if names := raw["tag"]; len(names) > 0 {
+		tags, err := h.Whisparr.Tags(ctx)
+		if err != nil {
+			return opts, err
+		}
+		var candidates []string
+		ids := map[string]int{}
+		for _, tag := range tags {
+			candidates = append(candidates, tag.Label)
+			ids[strings.ToLower(tag.Label)] = tag.ID
+		}
+		for _, name := range names {
+			id, ok := ids[strings.ToLower(name)]
+			if !ok {
+				return opts, unknownOptionError("tag", name, candidates, "whisparr tags")
+			}
+			opts.Tags = append(opts.Tags, id)
+		}
+	}
+	return opts, nil
+}
+
+func unknownOptionError(kind string, name string, candidates []string, listCommand string) error {
+	msg := fmt.Sprintf("unknown %s `%s`", kind, name)
+	if suggestions := fuzzy.Closest(name, candidates, 3); len(suggestions) > 0 {
+		msg += fmt.Sprintf(", did you mean: %s?", strings.Join(suggestions, ", "))
+	}
+	return fmt.Errorf("%s (see `%s`)", msg, listCommand)
+}
+
+// sceneArg reads a scene ID from a stashdb scene link or a bare ID.
+func sceneArg(arg string) (string, error) {
+	sceneID := strings.TrimSpace(arg)
+	if link, err := ParseStashLink(sceneID); err == nil {
+		if link.Kind != stashScene {
+			return "", fmt.Errorf("that isn't a scene link")
+		}
+		sceneID = link.ID
+	}
+	if sceneID == "" || strings.ContainsAny(sceneID, " /") {
+		return "", fmt.Errorf("no scene given")
+	}
+	return sceneID, nil
+}
+
+// libraryScene returns the library copy of the scene a link or ID names.
+func (h *StashHandler) libraryScene(ctx context.Context, arg string) (whisparr.Movie, error) {
+	sceneID, err := sceneArg(arg)
+	if err != nil {
+		return whisparr.Movie{}, err
+	}
+	movie, err := h.Whisparr.LookupScene(ctx, sceneID)
+	if errors.Is(err, whisparr.ErrNotFound) || (err == nil && !movie.InLibrary()) {
+		return whisparr.Movie{}, fmt.Errorf("scene `%s` isn't in Whispar", sceneID)
+	}
+	if err != nil {
+		return whisparr.Movie{}, err
+	}
+	return movie, nil
+}
+
+// handleStatusCommand shows where a scene is: not in Whisparr, waiting for a
+// release, downloading or imported. It takes a stashdb link or a scene ID.
+func (h *StashHandler) handleStatusCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) error {
+	sceneID, err := sceneArg(args)
+	if err != nil {
+		return fmt.Errorf("usage: status <stashdb scene link or id>")
+	}
+
+	ctx := context.Background()
+	movie, err := h.Whisparr.LookupScene(ctx, sceneID)
+	if errors.Is(err, whisparr.ErrNotFound) || (err == nil && !movie.InLibrary()) {
+		s.ChannelMessageSendReply(m.ChannelID, fmt.Sprintf("Scene `%s` isn't in Whispar.", sceneID), m.Reference())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// lookups don't include the file, so fetch the library copy
+	if movie, err = h.Whisparr.Movie(ctx, movie.ID); err != nil {
+		return err
+	}
+	queue, err := h.Whisparr.Queue(ctx)
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, item := range queue {
+		if item.MovieID == movie.ID {
+			lines = append(lines, formatQueueItem(item))
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, formatMovieStatus(movie))
+	}
+	s.ChannelMessageSendReply(m.ChannelID, strings.Join(lines, "\n"), m.Reference())
+	return nil
+}
+
+// handleQueueCommand lists what Whisparr is downloading.
+func (h *StashHandler) handleQueueCommand(s *discordgo.Session, m *discordgo.MessageCreate) error {
+	queue, err := h.Whisparr.Queue(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(queue) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "Whispar's queue is empty.")
+		return nil
+	}
+	lines := []string{fmt.Sprintf("Whispar's queue (%d):", len(queue))}
+	for idx, item := range queue {
+		if idx == maxQueueLines {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(queue)-maxQueueLines))
+			break
+		}
+		lines = append(lines, formatQueueItem(item))
+	}
+	s.ChannelMessageSend(m.ChannelID, strings.Join(lines, "\n"))
+	return nil
+}
+
+func formatQueueItem(item whisparr.QueueItem) string {
+	title := item.Title
+	if item.Movie != nil && item.Movie.Title != "" {
+		title = item.Movie.Title
+	}
+	state := item.TrackedDownloadState
+	if state == "" {
+		state = item.Status
+	}
+	line := fmt.Sprintf("⬇️ %s — %s %.0f%% of %s", title, strings.ToLower(state), item.Progress()*100, formatSize(int64(item.Size)))
+	if item.TimeLeft != "" {
+		line += ", ETA " + item.TimeLeft
+	}
+	if q := item.Quality.String(); q != "" {
+		line += ", " + q
+	}
+	if item.ErrorMessage != "" {
+		line += fmt.Sprintf(" ⚠️ %s", item.ErrorMessage)
+	}
+	return line
+}
+
+func formatMovieStatus(movie whisparr.Movie) string {
+	switch {
+	case movie.HasFile && movie.MovieFile != nil:
+		return fmt.Sprintf("✅ %s — imported, %s, %s", movie.Title, movie.MovieFile.Quality.String(), formatSize(movie.MovieFile.Size))
+	case movie.HasFile:
+		return fmt.Sprintf("✅ %s — imported", movie.Title)
+	case movie.Monitored:
+		return fmt.Sprintf("⏳ %s — monitored, waiting for a release", movie.Title)
+	default:
+		return fmt.Sprintf("⏸️ %s — in Whispar but not monitored", movie.Title)
+	}
+}
+
+// formatSize formats a byte count in the largest binary unit that keeps it at
+// least one.
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
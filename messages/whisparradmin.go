@@ -0,0 +1,135 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	stashUnmonitorID = StashComponentPrefix + ":unmonitor"
+	stashRemoveID    = StashComponentPrefix + ":remove"
+	stashDismissID   = StashComponentPrefix + ":dismiss"
+)
+
+// handleSearchCommand asks Whisparr to search its indexers for a scene again.
+func (h *StashHandler) handleSearchCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) error {
+	ctx := context.Background()
+	movie, err := h.libraryScene(ctx, args)
+	if err != nil {
+		return err
+	}
+	if err := h.Whisparr.SearchMovies(ctx, []int{movie.ID}); err != nil {
+		return err
+	}
+	s.ChannelMessageSendReply(m.ChannelID, fmt.Sprintf("🔍 Searching for %s", movie.Title), m.Reference())
+	return nil
+}
+
+// handleUnmonitorCommand asks an admin to confirm they want Whisparr to stop
+// monitoring a scene.
+func (h *StashHandler) handleUnmonitorCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) error {
+	if !h.isWhisparrAdmin(s, m.Author.ID, m.ChannelID, m.Member) {
+		return fmt.Errorf("only Whispar admins can unmonitor scenes")
+	}
+	movie, err := h.libraryScene(context.Background(), args)
+	if err != nil {
+		return err
+	}
+	return sendConfirmation(s, m, fmt.Sprintf("Stop monitoring **%s**?", movie.Title),
+		"Unmonitor", fmt.Sprintf("%s|%d", stashUnmonitorID, movie.ID))
+}
+
+// handleRemoveCommand asks an admin to confirm they want a scene removed from
+// Whisparr, along with its files when --files is given.
+func (h *StashHandler) handleRemoveCommand(s *discordgo.Session, m *discordgo.MessageCreate, args string) error {
+	if !h.isWhisparrAdmin(s, m.Author.ID, m.ChannelID, m.Member) {
+		return fmt.Errorf("only Whispar admins can remove scenes")
+	}
+	fields := strings.Fields(args)
+	deleteFiles := slices.Contains(fields, "--files")
+	fields = slices.DeleteFunc(fields, func(f string) bool { return f == "--files" })
+	movie, err := h.libraryScene(context.Background(), strings.Join(fields, " "))
+	if err != nil {
+		return err
+	}
+	prompt := fmt.Sprintf("Remove **%s** from Whispar?", movie.Title)
+	if deleteFiles {
+		prompt = fmt.Sprintf("Remove **%s** from Whispar and delete its files?", movie.Title)
+	}
+	return sendConfirmation(s, m, prompt,
+		"Remove", fmt.Sprintf("%s|%d|%t", stashRemoveID, movie.ID, deleteFiles))
+}
+
+// sendConfirmation replies with a prompt and buttons to go ahead or dismiss it.
+func sendConfirmation(s *discordgo.Session, m *discordgo.MessageCreate, prompt string, label string, customID string) error {
+	_, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Content: prompt,
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: label, Style: discordgo.DangerButton, CustomID: customID},
+				discordgo.Button{Label: "Cancel", Style: discordgo.SecondaryButton, CustomID: stashDismissID},
+			}},
+		},
+		Reference: m.Reference(),
+	})
+	return err
+}
+
+// handleManageInteraction carries out a confirmed unmonitor or remove, or
+// dismisses the prompt. Only Whispar admins may answer the prompt.
+func (h *StashHandler) handleManageInteraction(s *discordgo.Session, i *discordgo.InteractionCreate, action string, args []string) {
+	user := interactionUser(i)
+	if !h.isWhisparrAdmin(s, user.ID, i.ChannelID, i.Member) {
+		respondEphemeral(s, i, "Only Whispar admins can do that.")
+		return
+	}
+	if action == stashDismissID {
+		updatePreview(s, i, "Cancelled.")
+		return
+	}
+	if len(args) == 0 {
+		respondEphemeral(s, i, "That prompt is broken.")
+		return
+	}
+	movieID, err := strconv.Atoi(args[0])
+	if err != nil {
+		respondEphemeral(s, i, "That prompt is broken.")
+		return
+	}
+
+	ctx := context.Background()
+	var content string
+	switch action {
+	case stashUnmonitorID:
+		err = h.Whisparr.SetMonitored(ctx, []int{movieID}, false)
+		content = "⏸️ No longer monitored."
+	case stashRemoveID:
+		deleteFiles := len(args) > 1 && args[1] == "true"
+		err = h.Whisparr.DeleteMovie(ctx, movieID, deleteFiles)
+		content = "🗑️ Removed from Whispar."
+		if deleteFiles {
+			content = "🗑️ Removed from Whispar and deleted its files."
+		}
+	}
+	if err != nil {
+		log.Printf("failed to %s movie %d: %v", strings.TrimPrefix(action, StashComponentPrefix+":"), movieID, err)
+		content = fmt.Sprintf("Error updating Whispar: %v", err)
+	}
+	log.Printf("%s confirmed %s of movie %d", user.Username, action, movieID)
+	updatePreview(s, i, content)
+}
+
+// isWhisparrAdmin reports whether the user has the configured Whisparr admin
+// role, or can manage the server when no role is configured.
+func (h *StashHandler) isWhisparrAdmin(s *discordgo.Session, userID string, channelID string, member *discordgo.Member) bool {
+	if h.AdminRoleID == "" {
+		return isAdmin(s, userID, channelID)
+	}
+	return member != nil && slices.Contains(member.Roles, h.AdminRoleID)
+}
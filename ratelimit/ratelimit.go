@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter is a set of token buckets, one per key. Each bucket holds up to
+// burst tokens and regains one every interval.
+type Limiter struct {
+	mu       sync.Mutex
+	burst    float64
+	interval time.Duration
+	buckets  map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter allowing burst actions at once and one more every
+// interval after that. A burst or interval of 0 disables the limiter.
+func New(burst int, interval time.Duration) *Limiter {
+	return &Limiter{
+		burst:    float64(burst),
+		interval: interval,
+		buckets:  map[string]*bucket{},
+	}
+}
+
+func (l *Limiter) disabled() bool {
+	return l == nil || l.burst <= 0 || l.interval <= 0
+}
+
+// TryTake uses up one of key's tokens and returns 0 if it has one, or returns
+// how long key has to wait for its next token without using anything up.
+func (l *Limiter) TryTake(key string, now time.Time) time.Duration {
+	if l.disabled() {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if wait := l.wait(key, now); wait > 0 {
+		return wait
+	}
+	l.take(key, now)
+	return 0
+}
+
+// wait and take expect l.mu to be held.
+func (l *Limiter) wait(key string, now time.Time) time.Duration {
+	if l.disabled() {
+		return 0
+	}
+	b := l.refill(key, now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(l.interval))
+}
+
+func (l *Limiter) take(key string, now time.Time) {
+	if l.disabled() {
+		return
+	}
+	b := l.refill(key, now)
+	b.tokens = max(b.tokens-1, 0)
+}
+
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		return b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(l.burst, b.tokens+float64(elapsed)/float64(l.interval))
+		b.last = now
+	}
+	return b
+}
+
+// Quota counts actions per key per UTC day.
+type Quota struct {
+	mu    sync.Mutex
+	limit int
+	day   string
+	used  map[string]int
+}
+
+// NewQuota returns a quota allowing limit actions per key each day. A limit
+// of 0 disables the quota.
+func NewQuota(limit int) *Quota {
+	return &Quota{limit: limit, used: map[string]int{}}
+}
+
+func (q *Quota) disabled() bool {
+	return q == nil || q.limit <= 0
+}
+
+// TryTake counts one action against key's quota for today and returns 0 if
+// there is any left, or returns how long until the quota resets (the next UTC
+// midnight) without counting anything.
+func (q *Quota) TryTake(key string, now time.Time) time.Duration {
+	if q.disabled() {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if wait := q.wait(key, now); wait > 0 {
+		return wait
+	}
+	q.take(key, now)
+	return 0
+}
+
+// wait and take expect q.mu to be held.
+func (q *Quota) wait(key string, now time.Time) time.Duration {
+	if q.disabled() {
+		return 0
+	}
+	q.reset(now)
+	if q.used[key] < q.limit {
+		return 0
+	}
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC).Sub(now)
+}
+
+func (q *Quota) take(key string, now time.Time) {
+	if q.disabled() {
+		return
+	}
+	q.reset(now)
+	q.used[key]++
+}
+
+func (q *Quota) reset(now time.Time) {
+	day := now.UTC().Format(time.DateOnly)
+	if day != q.day {
+		q.day = day
+		q.used = map[string]int{}
+	}
+}
+
+// Denial says which limit stopped an action.
+type Denial int
+
+const (
+	Allowed Denial = iota
+	QuotaReached
+	UserLimited
+	ChannelLimited
+)
+
+// Limits combines a daily quota per user with token buckets per user and per
+// channel, checking and using them up together so concurrent actions can't
+// both get through on the last token.
+type Limits struct {
+	mu       sync.Mutex
+	quota    *Quota
+	users    *Limiter
+	channels *Limiter
+}
+
+// NewLimits returns limits built from the given quota and limiters, which
+// should only be used through the returned Limits from then on.
+func NewLimits(quota *Quota, users *Limiter, channels *Limiter) *Limits {
+	return &Limits{quota: quota, users: users, channels: channels}
+}
+
+// Allow uses up one of the user's quota, one of the user's tokens and one of
+// the channel's tokens if all of them are available, returning Allowed.
+// Otherwise nothing is used up and it returns the first limit that stopped
+// the action and how long until it allows another.
+func (l *Limits) Allow(user string, channel string, now time.Time) (Denial, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if wait := l.quota.wait(user, now); wait > 0 {
+		return QuotaReached, wait
+	}
+	if wait := l.users.wait(user, now); wait > 0 {
+		return UserLimited, wait
+	}
+	if wait := l.channels.wait(channel, now); wait > 0 {
+		return ChannelLimited, wait
+	}
+	l.quota.take(user, now)
+	l.users.take(user, now)
+	l.channels.take(channel, now)
+	return Allowed, 0
+}
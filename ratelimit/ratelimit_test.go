@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 9, 2, 12, 0, 0, 0, time.UTC)
+
+func TestLimiterRefill(t *testing.T) {
+	l := New(2, time.Minute)
+	steps := []struct {
+		key   string
+		after time.Duration
+		want  time.Duration
+	}{
+		{"a", 0, 0},
+		{"a", 0, 0},
+		// the burst is used up
+		{"a", 0, time.Minute},
+		// other keys have their own bucket
+		{"b", 0, 0},
+		// half a token back
+		{"a", 30 * time.Second, 30 * time.Second},
+		{"a", time.Minute, 0},
+		{"a", time.Minute, time.Minute},
+		// a long wait only refills up to the burst
+		{"a", time.Hour, 0},
+		{"a", time.Hour, 0},
+		{"a", time.Hour, time.Minute},
+	}
+	for idx, step := range steps {
+		if got := l.TryTake(step.key, start.Add(step.after)); got != step.want {
+			t.Errorf("step %d: TryTake(%q, +%v) = %v, want %v", idx, step.key, step.after, got, step.want)
+		}
+	}
+}
+
+func TestQuotaResetsAtUTCMidnight(t *testing.T) {
+	q := NewQuota(2)
+	beforeMidnight := time.Date(2024, 9, 2, 23, 59, 30, 0, time.UTC)
+	steps := []struct {
+		at   time.Time
+		want time.Duration
+	}{
+		{beforeMidnight, 0},
+		{beforeMidnight, 0},
+		{beforeMidnight, 30 * time.Second},
+		// already the 3rd locally, but still the 2nd in UTC
+		{beforeMidnight.In(time.FixedZone("UTC+2", 2*60*60)).Add(10 * time.Second), 20 * time.Second},
+		{time.Date(2024, 9, 3, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(2024, 9, 3, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(2024, 9, 3, 0, 0, 0, 0, time.UTC), 24 * time.Hour},
+	}
+	for idx, step := range steps {
+		if got := q.TryTake("a", step.at); got != step.want {
+			t.Errorf("step %d: TryTake(%v) = %v, want %v", idx, step.at, got, step.want)
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	var nilLimiter *Limiter
+	var nilQuota *Quota
+	tests := []struct {
+		name string
+		take func() time.Duration
+	}{
+		{"no burst", func() time.Duration { return New(0, time.Minute).TryTake("a", start) }},
+		{"no interval", func() time.Duration { return New(1, 0).TryTake("a", start) }},
+		{"nil limiter", func() time.Duration { return nilLimiter.TryTake("a", start) }},
+		{"no quota", func() time.Duration { return NewQuota(0).TryTake("a", start) }},
+		{"nil quota", func() time.Duration { return nilQuota.TryTake("a", start) }},
+	}
+	for _, tt := range tests {
+		for range 3 {
+			if got := tt.take(); got != 0 {
+				t.Errorf("%s: TryTake = %v, want 0", tt.name, got)
+				break
+			}
+		}
+	}
+}
+
+func TestLimitsAllow(t *testing.T) {
+	l := NewLimits(NewQuota(3), New(1, time.Minute), New(2, time.Minute))
+	steps := []struct {
+		user, channel string
+		after         time.Duration
+		want          Denial
+		wantWait      time.Duration
+	}{
+		{"a", "1", 0, Allowed, 0},
+		{"a", "1", 0, UserLimited, time.Minute},
+		{"b", "1", 0, Allowed, 0},
+		{"c", "1", 0, ChannelLimited, time.Minute},
+		// being denied by the channel didn't use up c's token
+		{"c", "2", 0, Allowed, 0},
+		{"a", "2", time.Minute, Allowed, 0},
+		{"a", "2", 2 * time.Minute, Allowed, 0},
+		// a has used its 3 for the day, until UTC midnight
+		{"a", "2", 3 * time.Minute, QuotaReached, 11*time.Hour + 57*time.Minute},
+	}
+	for idx, step := range steps {
+		got, wait := l.Allow(step.user, step.channel, start.Add(step.after))
+		if got != step.want || wait != step.wantWait {
+			t.Errorf("step %d: Allow(%q, %q, +%v) = %v, %v, want %v, %v", idx, step.user, step.channel, step.after, got, wait, step.want, step.wantWait)
+		}
+	}
+}